@@ -7,20 +7,46 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 )
 
 type Backend interface {
 	GetAllUrls() ([]ReturnedUrl, error)
+	GetUrl(urlId uint64) (UrlDetails, error)
 	GetFetcherHistory(urlId uint64) ([]UrlResponse, error)
+	QueryFetcherHistory(urlId uint64, query HistoryQuery) (HistoryPage, error)
+	GetFetcherResponse(urlId uint64, seq uint64) (UrlResponse, error)
+	GetFetcherDiff(urlId uint64, fromSeq uint64, toSeq uint64) (ResponseDiff, error)
 	PostNewUrl(url NewUrl) (UrlId, error)
+	PatchUrl(urlId uint64, patch UrlPatch) error
 	DeleteUrl(urlId uint64) error
+	// PauseUrl stops fetching of url, keeping its definition and history. ResumeUrl starts it again.
+	// Both do nothing if url is already in requested state.
+	PauseUrl(urlId uint64) error
+	ResumeUrl(urlId uint64) error
+	// Subscribe starts stream of responses recorded from now on (or after query.LastEventId)
+	Subscribe(query StreamQuery) (Subscription, error)
+}
+
+// WorkerStatsSource is implemented by worker which makes requests for Backend
+type WorkerStatsSource interface {
+	GetWorkerStats() WorkerStats
+}
+
+// DeliveryLogSource is implemented by notifier which delivers notifications to webhooks
+type DeliveryLogSource interface {
+	// GetDeliveries returns recent deliveries (newest first) of notifications about url with given id, or about all urls if urlId is nil
+	GetDeliveries(urlId *uint64) []Delivery
 }
 
 const (
 	BackendErrorNotFound = "not found"
-	MaxPostBodySize      = 1000000
+	// Prefix of errors returned by Backend when request is correct json, but cannot be applied
+	BackendErrorBadRequest = "bad request"
+	MaxPostBodySize        = 1000000
 )
 
 func Create(r chi.Router, backend Backend) {
@@ -29,9 +55,41 @@ func Create(r chi.Router, backend Backend) {
 	}
 	r.Route("/api/fetcher", func(r chi.Router) {
 		r.Get("/", a.handleGetAllUrls)
+		r.Get("/stream", a.handleStream)
+		r.Get("/ws", a.handleWebSocket)
+		r.Get("/{id}", a.handleGetUrl)
 		r.Get("/{id}/history", a.handleGetFetcherHistory)
+		r.Get("/{id}/history/{seq}/body", a.handleGetResponseBody)
+		r.Get("/{id}/diff", a.handleGetFetcherDiff)
+		r.Get("/{id}/stream", a.handleStream)
 		r.Post("/", a.handlePostNewUrl)
+		r.Patch("/{id}", a.handlePatchUrl)
 		r.Delete("/{id}", a.handleDeleteUrl)
+		r.Post("/{id}/pause", a.handlePauseUrl)
+		r.Post("/{id}/resume", a.handleResumeUrl)
+	})
+}
+
+// CreateWorkerStats adds endpoint exposing saturation of worker pool
+func CreateWorkerStats(r chi.Router, source WorkerStatsSource) {
+	r.Get("/api/worker/stats", func(writer http.ResponseWriter, request *http.Request) {
+		encodeJsonResponse(writer, source.GetWorkerStats())
+	})
+}
+
+// CreateNotifications adds endpoint exposing log of deliveries of notifications to webhooks
+func CreateNotifications(r chi.Router, source DeliveryLogSource) {
+	r.Get("/api/notifications/deliveries", func(writer http.ResponseWriter, request *http.Request) {
+		var urlId *uint64
+		if value := request.URL.Query().Get("url_id"); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				http.Error(writer, fmt.Sprintf("invalid url_id - expected id of url, got %s", value), http.StatusBadRequest)
+				return
+			}
+			urlId = &id
+		}
+		encodeJsonResponse(writer, source.GetDeliveries(urlId))
 	})
 }
 
@@ -48,34 +106,107 @@ func (a *api) handleGetAllUrls(writer http.ResponseWriter, request *http.Request
 	encodeJsonResponse(writer, urls)
 }
 
+func (a *api) handleGetUrl(writer http.ResponseWriter, request *http.Request) {
+	id, err := getIdFromRequest(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	url, err := a.backend.GetUrl(id)
+	if err != nil {
+		writeErrorInHttpResponse(writer, err)
+		return
+	}
+	encodeJsonResponse(writer, url)
+}
+
 func (a *api) handleGetFetcherHistory(writer http.ResponseWriter, request *http.Request) {
 	id, err := getIdFromRequest(request)
 	if err != nil {
 		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
-	history, err := a.backend.GetFetcherHistory(id)
+	if request.URL.RawQuery == "" {
+		history, err := a.backend.GetFetcherHistory(id)
+		if err != nil {
+			writeErrorInHttpResponse(writer, err)
+			return
+		}
+		encodeJsonResponse(writer, history)
+		return
+	}
+	query, err := getHistoryQueryFromRequest(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := a.backend.QueryFetcherHistory(id, query)
 	if err != nil {
 		writeErrorInHttpResponse(writer, err)
 		return
 	}
-	encodeJsonResponse(writer, history)
+	encodeJsonResponse(writer, page)
 }
 
-func (a *api) handlePostNewUrl(writer http.ResponseWriter, request *http.Request) {
-	limitedReader := io.LimitReader(request.Body, MaxPostBodySize)
-	data, err := ioutil.ReadAll(limitedReader)
+// handleGetResponseBody returns raw body of response with given seq, with its original content type. Body comes from
+// remote server, so browsers must not render it as page of this origin (scripts in it could call the API).
+func (a *api) handleGetResponseBody(writer http.ResponseWriter, request *http.Request) {
+	id, err := getIdFromRequest(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	seq, err := strconv.ParseUint(chi.URLParam(request, "seq"), 10, 64)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	response, err := a.backend.GetFetcherResponse(id, seq)
 	if err != nil {
 		writeErrorInHttpResponse(writer, err)
 		return
 	}
-	if len(data) == MaxPostBodySize {
-		http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	if response.Response == nil {
+		http.Error(writer, "Response has no body", http.StatusNotFound)
+		return
+	}
+	contentType := response.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.Header().Set("Content-Security-Policy", "sandbox")
+	writer.Header().Set("Content-Disposition", "attachment")
+	_, _ = writer.Write(response.Response)
+}
+
+// handleGetFetcherDiff returns difference between bodies of responses given by seq in query parameters from and to
+func (a *api) handleGetFetcherDiff(writer http.ResponseWriter, request *http.Request) {
+	id, err := getIdFromRequest(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
+	var seqs [2]uint64
+	for i, key := range []string{"from", "to"} {
+		value := request.URL.Query().Get(key)
+		if seqs[i], err = strconv.ParseUint(value, 10, 64); err != nil {
+			http.Error(writer, fmt.Sprintf("invalid %s - expected seq of response, got %s", key, value), http.StatusBadRequest)
+			return
+		}
+	}
+	responseDiff, err := a.backend.GetFetcherDiff(id, seqs[0], seqs[1])
+	if err != nil {
+		writeErrorInHttpResponse(writer, err)
+		return
+	}
+	encodeJsonResponse(writer, responseDiff)
+}
+
+func (a *api) handlePostNewUrl(writer http.ResponseWriter, request *http.Request) {
 	var newUrl NewUrl
-	if err := json.Unmarshal(data, &newUrl); err != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	if !decodeJsonRequest(writer, request, &newUrl) {
 		return
 	}
 	newUrlId, err := a.backend.PostNewUrl(newUrl)
@@ -86,6 +217,22 @@ func (a *api) handlePostNewUrl(writer http.ResponseWriter, request *http.Request
 	encodeJsonResponse(writer, newUrlId)
 }
 
+func (a *api) handlePatchUrl(writer http.ResponseWriter, request *http.Request) {
+	id, err := getIdFromRequest(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	var patch UrlPatch
+	if !decodeJsonRequest(writer, request, &patch) {
+		return
+	}
+	if err := a.backend.PatchUrl(id, patch); err != nil {
+		writeErrorInHttpResponse(writer, err)
+		return
+	}
+}
+
 func (a *api) handleDeleteUrl(writer http.ResponseWriter, request *http.Request) {
 	id, err := getIdFromRequest(request)
 	if err != nil {
@@ -98,19 +245,109 @@ func (a *api) handleDeleteUrl(writer http.ResponseWriter, request *http.Request)
 	}
 }
 
+func (a *api) handlePauseUrl(writer http.ResponseWriter, request *http.Request) {
+	id, err := getIdFromRequest(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err := a.backend.PauseUrl(id); err != nil {
+		writeErrorInHttpResponse(writer, err)
+		return
+	}
+}
+
+func (a *api) handleResumeUrl(writer http.ResponseWriter, request *http.Request) {
+	id, err := getIdFromRequest(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err := a.backend.ResumeUrl(id); err != nil {
+		writeErrorInHttpResponse(writer, err)
+		return
+	}
+}
+
 func getIdFromRequest(request *http.Request) (uint64, error) {
 	idStr := chi.URLParam(request, "id")
 	idInt, err := strconv.ParseUint(idStr, 10, 64)
 	return idInt, err
 }
 
+// decodeJsonRequest reads request body (limited to MaxPostBodySize) into data.
+// On failure, it writes error response and returns false.
+func decodeJsonRequest(writer http.ResponseWriter, request *http.Request, data interface{}) bool {
+	limitedReader := io.LimitReader(request.Body, MaxPostBodySize)
+	body, err := ioutil.ReadAll(limitedReader)
+	if err != nil {
+		writeErrorInHttpResponse(writer, err)
+		return false
+	}
+	if len(body) == MaxPostBodySize {
+		http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if err := json.Unmarshal(body, data); err != nil {
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func getHistoryQueryFromRequest(request *http.Request) (HistoryQuery, error) {
+	var query HistoryQuery
+	for key, values := range request.URL.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "from", "to":
+			unixTime, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return HistoryQuery{}, fmt.Errorf("invalid %s - expected unix time, got %s", key, value)
+			}
+			if key == "from" {
+				query.From = time.Unix(unixTime, 0)
+			} else {
+				query.To = time.Unix(unixTime, 0)
+			}
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				return HistoryQuery{}, fmt.Errorf("invalid limit - expected positive integer, got %s", value)
+			}
+			query.Limit = limit
+		case "cursor":
+			cursor, err := ParseHistoryCursor(value)
+			if err != nil {
+				return HistoryQuery{}, err
+			}
+			query.After = &cursor
+		case "order":
+			if value != HistoryOrderAsc && value != HistoryOrderDesc {
+				return HistoryQuery{}, fmt.Errorf("invalid order - expected %s or %s, got %s", HistoryOrderAsc, HistoryOrderDesc, value)
+			}
+			query.Order = value
+		default:
+			return HistoryQuery{}, fmt.Errorf("unexpected query parameter %s", key)
+		}
+	}
+	return query, nil
+}
+
 func writeErrorInHttpResponse(writer http.ResponseWriter, err error) {
+	status, message := errorStatus(err)
+	http.Error(writer, message, status)
+}
+
+// errorStatus returns http status and message of error returned by Backend
+func errorStatus(err error) (int, string) {
 	if err.Error() == BackendErrorNotFound {
-		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-	} else {
-		// Internal server errors in theory should not happen - handle it just as a sanity check
-		http.Error(writer, fmt.Sprintf("Internal Server error: %s", err), http.StatusInternalServerError)
+		return http.StatusNotFound, http.StatusText(http.StatusNotFound)
+	} else if strings.HasPrefix(err.Error(), BackendErrorBadRequest) {
+		return http.StatusBadRequest, err.Error()
 	}
+	// Internal server errors in theory should not happen - handle it just as a sanity check
+	return http.StatusInternalServerError, fmt.Sprintf("Internal Server error: %s", err)
 }
 
 func encodeJsonResponse(writer http.ResponseWriter, data interface{}) {
@@ -47,6 +47,111 @@ func TestApi(t *testing.T) {
 		})
 	})
 
+	t.Run("GET on /api/fetcher/{id} triggers GetUrl", func(t *testing.T) {
+		t.Run("with valid request returns status 200", func(t *testing.T) {
+			response, err := http.Get(server.URL + "/api/fetcher/11")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			responseBytes, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			expected := `{"id":11,"url":"https://httpbin.org/range/15","interval":60,"status":{"next_run":1559034698,` +
+				`"last_fetch":1559034638,"last_outcome":"failure","consecutive_failures":1,"total_fetches":3}}`
+			assert.Equal(t, expected, stringWithoutWhitespace(responseBytes))
+		})
+		t.Run("with internal server error returns status 500", func(t *testing.T) {
+			backend.SetInternalError()
+			defer backend.UnsetInternalError()
+			response, err := http.Get(server.URL + "/api/fetcher/11")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusInternalServerError, response.StatusCode)
+		})
+		t.Run("with non-integer id returns status 404", func(t *testing.T) {
+			response, err := http.Get(server.URL + "/api/fetcher/id")
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		})
+		t.Run("with non-existing id returns status 404", func(t *testing.T) {
+			response, err := http.Get(server.URL + "/api/fetcher/22")
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		})
+	})
+
+	t.Run("GET on /api/fetcher/{id}/history/{seq}/body triggers GetFetcherResponse", func(t *testing.T) {
+		t.Run("with valid request returns raw body with its content type", func(t *testing.T) {
+			for seq, expected := range map[string]struct {
+				body        []byte
+				contentType string
+			}{
+				"1": {body: []byte{0x89, 'P', 'N', 'G', 0}, contentType: "image/png"},
+				"2": {body: []byte("abc"), contentType: "application/octet-stream"},
+			} {
+				response, err := http.Get(server.URL + "/api/fetcher/11/history/" + seq + "/body")
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, response.StatusCode)
+				responseBytes, err := ioutil.ReadAll(response.Body)
+				require.NoError(t, err)
+				assert.Equal(t, expected.body, responseBytes, seq)
+				assert.Equal(t, expected.contentType, response.Header.Get("Content-Type"), seq)
+			}
+		})
+		t.Run("with html body forbids rendering it as page of API origin", func(t *testing.T) {
+			response, err := http.Get(server.URL + "/api/fetcher/11/history/4/body")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, "text/html", response.Header.Get("Content-Type"))
+			assert.Equal(t, "nosniff", response.Header.Get("X-Content-Type-Options"))
+			assert.Equal(t, "sandbox", response.Header.Get("Content-Security-Policy"))
+			assert.Equal(t, "attachment", response.Header.Get("Content-Disposition"))
+		})
+		t.Run("with response without body returns status 404", func(t *testing.T) {
+			response, err := http.Get(server.URL + "/api/fetcher/11/history/3/body")
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		})
+		t.Run("with non-existing or invalid id or seq returns status 404", func(t *testing.T) {
+			for _, path := range []string{"/api/fetcher/22/history/1/body", "/api/fetcher/11/history/5/body", "/api/fetcher/11/history/x/body"} {
+				response, err := http.Get(server.URL + path)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusNotFound, response.StatusCode, path)
+			}
+		})
+		t.Run("with internal server error returns status 500", func(t *testing.T) {
+			backend.SetInternalError()
+			defer backend.UnsetInternalError()
+			response, err := http.Get(server.URL + "/api/fetcher/11/history/1/body")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusInternalServerError, response.StatusCode)
+		})
+	})
+
+	t.Run("GET on /api/fetcher/{id}/diff triggers GetFetcherDiff", func(t *testing.T) {
+		t.Run("with valid request returns status 200", func(t *testing.T) {
+			response, err := http.Get(server.URL + "/api/fetcher/11/diff?from=1&to=2")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			responseBytes, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			expected := `{"from":1,"to":2,"equal":false,"unified":"--- seq 1\n+++ seq 2\n@@ -1 +1 @@\n-{\"a\":1}\n+{\"b\":null}\n",` +
+				`"json":[{"path":"$.a","op":"removed","from":1},{"path":"$.b","op":"added","to":null}]}`
+			assert.JSONEq(t, expected, string(responseBytes))
+		})
+		t.Run("with missing or invalid seq returns status 400", func(t *testing.T) {
+			for _, query := range []string{"", "?from=1", "?to=2", "?from=x&to=2", "?from=1&to=-2"} {
+				response, err := http.Get(server.URL + "/api/fetcher/11/diff" + query)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+			}
+		})
+		t.Run("with non-existing url or response returns status 404", func(t *testing.T) {
+			for _, path := range []string{"/api/fetcher/22/diff?from=1&to=2", "/api/fetcher/11/diff?from=1&to=4"} {
+				response, err := http.Get(server.URL + path)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusNotFound, response.StatusCode, path)
+			}
+		})
+	})
+
 	t.Run("GET on /api/fetcher/{id}/history triggers GetFetcherHistory", func(t *testing.T) {
 		t.Run("with valid request returns status 200", func(t *testing.T) {
 			response, err := http.Get(server.URL + "/api/fetcher/11/history")
@@ -56,6 +161,32 @@ func TestApi(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, `[{"response":null,"duration":0.571,"created_at":1559034638}]`, stringWithoutWhitespace(responseBytes))
 		})
+		t.Run("with query parameters returns page of history", func(t *testing.T) {
+			cursor := api.HistoryCursor{CreatedAt: time.Unix(1559034600, 0), Seq: 3}
+			response, err := http.Get(server.URL + "/api/fetcher/11/history?from=1559034000&to=1559035000&limit=1&order=desc&cursor=" + cursor.String())
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			responseBytes, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			expected := `{"responses":[{"seq":5,"response":null,"duration":0.571,"created_at":1559034638}],"next_cursor":"` +
+				api.HistoryCursor{CreatedAt: time.Unix(1559034638, 0), Seq: 5}.String() + `"}`
+			assert.Equal(t, expected, stringWithoutWhitespace(responseBytes))
+			expectedQuery := api.HistoryQuery{
+				From:  time.Unix(1559034000, 0),
+				To:    time.Unix(1559035000, 0),
+				Limit: 1,
+				After: &cursor,
+				Order: api.HistoryOrderDesc,
+			}
+			assert.Equal(t, expectedQuery, backend.lastHistoryQuery)
+		})
+		t.Run("with invalid query parameters returns status 400", func(t *testing.T) {
+			for _, query := range []string{"from=x", "to=1.5", "limit=0", "order=random", "cursor=x", "key=value"} {
+				response, err := http.Get(server.URL + "/api/fetcher/11/history?" + query)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+			}
+		})
 		t.Run("with internal server error returns status 500", func(t *testing.T) {
 			backend.SetInternalError()
 			defer backend.UnsetInternalError()
@@ -107,6 +238,40 @@ func TestApi(t *testing.T) {
 		})
 	})
 
+	t.Run("PATCH on /api/fetcher/{id} triggers PatchUrl", func(t *testing.T) {
+		patch := func(path string, data string) *http.Response {
+			client := &http.Client{}
+			request, err := http.NewRequest("PATCH", server.URL+path, bytes.NewBufferString(data))
+			require.NoError(t, err)
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			return response
+		}
+		t.Run("with valid request returns status 200", func(t *testing.T) {
+			response := patch("/api/fetcher/11", `{"interval":30}`)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, 30, *backend.lastPatch.IntervalSeconds)
+		})
+		t.Run("with invalid json returns status 400", func(t *testing.T) {
+			response := patch("/api/fetcher/11", `{}`)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		})
+		t.Run("with patch rejected by backend returns status 400", func(t *testing.T) {
+			response := patch("/api/fetcher/11", `{"interval":1}`)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		})
+		t.Run("with non-existing id returns status 404", func(t *testing.T) {
+			response := patch("/api/fetcher/22", `{"interval":30}`)
+			assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		})
+		t.Run("with internal server error returns status 500", func(t *testing.T) {
+			backend.SetInternalError()
+			defer backend.UnsetInternalError()
+			response := patch("/api/fetcher/11", `{"interval":30}`)
+			assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+		})
+	})
+
 	t.Run("DELETE on /api/fetcher/{id} triggers DeleteUrl", func(t *testing.T) {
 		t.Run("with valid request returns status 200", func(t *testing.T) {
 			client := &http.Client{}
@@ -139,6 +304,31 @@ func TestApi(t *testing.T) {
 			assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
 		})
 	})
+
+	for _, action := range []string{"pause", "resume"} {
+		t.Run("POST on /api/fetcher/{id}/"+action+" changes state of url", func(t *testing.T) {
+			t.Run("with valid request returns status 200", func(t *testing.T) {
+				response, err := http.Post(server.URL+"/api/fetcher/11/"+action, "", nil)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, response.StatusCode)
+				assert.Equal(t, action, backend.lastStateChange)
+			})
+			t.Run("with non-integer or non-existing id returns status 404", func(t *testing.T) {
+				for _, id := range []string{"i", "22"} {
+					response, err := http.Post(server.URL+"/api/fetcher/"+id+"/"+action, "", nil)
+					require.NoError(t, err)
+					assert.Equal(t, http.StatusNotFound, response.StatusCode)
+				}
+			})
+			t.Run("with internal server error returns status 500", func(t *testing.T) {
+				backend.SetInternalError()
+				defer backend.UnsetInternalError()
+				response, err := http.Post(server.URL+"/api/fetcher/11/"+action, "", nil)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+			})
+		})
+	}
 }
 
 func stringWithoutWhitespace(bytes []byte) string {
@@ -152,8 +342,83 @@ func stringWithoutWhitespace(bytes []byte) string {
 	return strings.Map(mapFunc, string(bytes))
 }
 
+func TestWorkerStats(t *testing.T) {
+	r := chi.NewRouter()
+	api.CreateWorkerStats(r, fakeWorkerStatsSource{})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/api/worker/stats")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"executors":4,"busy":3,"saturation":0.75,"queue_depth":7,"fetchers":20}`, stringWithoutWhitespace(responseBytes))
+}
+
+func TestNotifications(t *testing.T) {
+	r := chi.NewRouter()
+	source := &fakeDeliveryLogSource{}
+	api.CreateNotifications(r, source)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	t.Run("GET deliveries returns deliveries of all urls", func(t *testing.T) {
+		response, err := http.Get(server.URL + "/api/notifications/deliveries")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		responseBytes, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `[{"id":2,"url_id":5,"event":"up","webhook":"https://hooks.example.com/a","status":"delivered","attempts":1,"status_code":200,`+
+			`"created_at":1559034638,"last_attempt":1559034639}]`, stringWithoutWhitespace(responseBytes))
+		assert.Nil(t, source.lastUrlId)
+	})
+	t.Run("GET deliveries filters them by url", func(t *testing.T) {
+		response, err := http.Get(server.URL + "/api/notifications/deliveries?url_id=5")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.NotNil(t, source.lastUrlId)
+		assert.Equal(t, uint64(5), *source.lastUrlId)
+	})
+	t.Run("GET deliveries with invalid url id returns 400", func(t *testing.T) {
+		response, err := http.Get(server.URL + "/api/notifications/deliveries?url_id=x")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+}
+
+type fakeDeliveryLogSource struct {
+	lastUrlId *uint64
+}
+
+func (f *fakeDeliveryLogSource) GetDeliveries(urlId *uint64) []api.Delivery {
+	f.lastUrlId = urlId
+	return []api.Delivery{{
+		Id:          2,
+		UrlId:       5,
+		Event:       api.EventUp,
+		Webhook:     "https://hooks.example.com/a",
+		Status:      api.DeliveryDelivered,
+		Attempts:    1,
+		StatusCode:  200,
+		CreatedAt:   time.Unix(1559034638, 0),
+		LastAttempt: time.Unix(1559034639, 0),
+	}}
+}
+
+type fakeWorkerStatsSource struct{}
+
+func (fakeWorkerStatsSource) GetWorkerStats() api.WorkerStats {
+	return api.WorkerStats{Executors: 4, Busy: 3, Saturation: 0.75, QueueDepth: 7, Fetchers: 20}
+}
+
 type fakeBackend struct {
-	error error
+	error            error
+	lastPatch        api.UrlPatch
+	lastHistoryQuery api.HistoryQuery
+	lastStreamQuery  api.StreamQuery
+	lastStateChange  string // "pause" or "resume"
+	streamCancelled  bool
 }
 
 func (f *fakeBackend) SetInternalError() {
@@ -175,6 +440,27 @@ func (f *fakeBackend) GetAllUrls() ([]api.ReturnedUrl, error) {
 	return returnedUrls, f.error
 }
 
+func (f *fakeBackend) GetUrl(urlId uint64) (api.UrlDetails, error) {
+	if urlId != 11 {
+		return api.UrlDetails{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	details := api.UrlDetails{
+		ReturnedUrl: api.ReturnedUrl{
+			Id:          11,
+			UrlAsString: "https://httpbin.org/range/15",
+			Interval:    60,
+		},
+		Status: api.UrlStatus{
+			NextRun:             time.Unix(1559034698, 0),
+			LastFetch:           time.Unix(1559034638, 0),
+			LastOutcome:         api.OutcomeFailure,
+			ConsecutiveFailures: 1,
+			TotalFetches:        3,
+		},
+	}
+	return details, f.error
+}
+
 func (f *fakeBackend) GetFetcherHistory(urlId uint64) ([]api.UrlResponse, error) {
 	urlResponses := []api.UrlResponse{
 		{
@@ -190,10 +476,85 @@ func (f *fakeBackend) GetFetcherHistory(urlId uint64) ([]api.UrlResponse, error)
 	}
 }
 
+func (f *fakeBackend) QueryFetcherHistory(urlId uint64, query api.HistoryQuery) (api.HistoryPage, error) {
+	if urlId != 11 {
+		return api.HistoryPage{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	f.lastHistoryQuery = query
+	createdAt := time.Unix(1559034638, 0)
+	page := api.HistoryPage{
+		Responses: []api.UrlResponse{
+			{
+				Seq:       5,
+				Response:  nil,
+				Duration:  time.Duration(int64(0.571 * float64(time.Second))),
+				CreatedAt: createdAt,
+			},
+		},
+		NextCursor: &api.HistoryCursor{CreatedAt: createdAt, Seq: 5},
+	}
+	return page, f.error
+}
+
+func (f *fakeBackend) GetFetcherResponse(urlId uint64, seq uint64) (api.UrlResponse, error) {
+	if urlId != 11 || seq == 0 || seq > 4 {
+		return api.UrlResponse{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	responses := map[uint64]api.UrlResponse{
+		1: {Seq: 1, Response: []byte{0x89, 'P', 'N', 'G', 0}, ContentType: "image/png"},
+		2: {Seq: 2, Response: []byte("abc")},
+		3: {Seq: 3, Error: api.FetchErrorTimeout},
+		4: {Seq: 4, Response: []byte("<script>alert(1)</script>"), ContentType: "text/html"},
+	}
+	return responses[seq], f.error
+}
+
+func (f *fakeBackend) GetFetcherDiff(urlId uint64, fromSeq uint64, toSeq uint64) (api.ResponseDiff, error) {
+	if urlId != 11 || toSeq > 3 {
+		return api.ResponseDiff{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	return api.ResponseDiff{
+		From:    fromSeq,
+		To:      toSeq,
+		Unified: "--- seq 1\n+++ seq 2\n@@ -1 +1 @@\n-{\"a\":1}\n+{\"b\":null}\n",
+		Json: []api.JsonChange{
+			{Path: "$.a", Op: api.JsonChangeRemoved, From: 1},
+			{Path: "$.b", Op: api.JsonChangeAdded, To: nil},
+		},
+	}, f.error
+}
+
 func (f *fakeBackend) PostNewUrl(url api.NewUrl) (api.UrlId, error) {
 	return api.UrlId{Id: 11}, f.error
 }
 
+func (f *fakeBackend) PauseUrl(urlId uint64) error {
+	if urlId != 11 {
+		return fmt.Errorf(api.BackendErrorNotFound)
+	}
+	f.lastStateChange = "pause"
+	return f.error
+}
+
+func (f *fakeBackend) ResumeUrl(urlId uint64) error {
+	if urlId != 11 {
+		return fmt.Errorf(api.BackendErrorNotFound)
+	}
+	f.lastStateChange = "resume"
+	return f.error
+}
+
+func (f *fakeBackend) PatchUrl(urlId uint64, patch api.UrlPatch) error {
+	if urlId != 11 {
+		return fmt.Errorf(api.BackendErrorNotFound)
+	}
+	if patch.IntervalSeconds != nil && *patch.IntervalSeconds == 1 {
+		return fmt.Errorf("%s: timeout exceeds interval", api.BackendErrorBadRequest)
+	}
+	f.lastPatch = patch
+	return f.error
+}
+
 func (f *fakeBackend) DeleteUrl(urlId uint64) error {
 	if urlId == 11 {
 		return f.error
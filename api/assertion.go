@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"fetcher/jsonpath"
+)
+
+// Check of response made by worker after each fetch - exactly one of fields is set (JsonEquals only with JsonPath).
+// Checks of body fail if there is no body (e.g. http status is not 2xx).
+type Assertion struct {
+	StatusCodes  []int         // http status code is one of given
+	MaxLatency   time.Duration // request takes at most given time
+	BodyContains string        // body contains given text
+	BodyRegex    string        // body matches regular expression (RE2 syntax, see package regexp)
+	JsonPath     string        // body is json with value at given path (see package jsonpath) equal to JsonEquals
+	JsonEquals   interface{}   // value decoded by encoding/json
+	Header       string        // response has given header (its value is recorded in history)
+}
+
+// Kinds of assertions (their keys in json)
+const (
+	AssertionStatusCodes  = "status_codes"
+	AssertionMaxLatency   = "max_latency"
+	AssertionBodyContains = "body_contains"
+	AssertionBodyRegex    = "body_regex"
+	AssertionJsonPath     = "json_path"
+	AssertionHeader       = "header"
+)
+
+// Result of assertion (with the same index in NewUrl.Assertions) for response
+type AssertionResult struct {
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"` // why assertion failed
+}
+
+// Health of url, determined by its newest response
+const (
+	HealthHealthy  = "healthy"  // response was fetched and passed all assertions
+	HealthDegraded = "degraded" // response was fetched, but some assertion failed
+	HealthDown     = "down"     // url could not be fetched - http status other than 2xx is failure unless status_codes assertion passed
+)
+
+func (a *Assertion) UnmarshalJSON(j []byte) error {
+	return unmarshalObject(j, a.fromJsonValue)
+}
+
+func (a *Assertion) fromJsonValue(value interface{}) error {
+	o, err := parseObject("assertion", value)
+	if err != nil {
+		return err
+	}
+	if o.has(AssertionJsonPath) != o.has("equals") {
+		return fmt.Errorf("assertion keys json_path and equals must be used together")
+	}
+	for key := range o.fields {
+		switch key {
+		case AssertionStatusCodes:
+			a.StatusCodes, err = o.statusCodes(key, func(int) bool { return true })
+			if err == nil && len(a.StatusCodes) == 0 {
+				err = o.invalid(key, "non-empty array")
+			}
+		case AssertionMaxLatency:
+			a.MaxLatency, err = o.seconds(key)
+		case AssertionBodyContains:
+			a.BodyContains, err = o.nonEmptyString(key)
+		case AssertionBodyRegex:
+			a.BodyRegex, err = o.nonEmptyString(key)
+		case AssertionJsonPath:
+			a.JsonPath, err = o.nonEmptyString(key)
+		case AssertionHeader:
+			a.Header, err = o.nonEmptyString(key)
+			a.Header = http.CanonicalHeaderKey(a.Header)
+		case "equals":
+			a.JsonEquals = o.fields[key]
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return a.Validate()
+}
+
+// Validate checks that exactly one kind of assertion is set and that regular expression and json path are valid
+func (a *Assertion) Validate() error {
+	set := 0
+	for _, isSet := range []bool{a.StatusCodes != nil, a.MaxLatency != 0, a.BodyContains != "", a.BodyRegex != "", a.JsonPath != "", a.Header != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("expected exactly one of assertion keys %s, %s, %s, %s, %s, %s", AssertionStatusCodes,
+			AssertionMaxLatency, AssertionBodyContains, AssertionBodyRegex, AssertionJsonPath, AssertionHeader)
+	}
+	if a.BodyRegex != "" {
+		if _, err := regexp.Compile(a.BodyRegex); err != nil {
+			return fmt.Errorf("invalid assertion body_regex: %s", err)
+		}
+	}
+	if a.JsonPath != "" {
+		if _, err := jsonpath.Parse(a.JsonPath); err != nil {
+			return fmt.Errorf("invalid assertion json_path: %s", err)
+		}
+	}
+	return nil
+}
+
+// Kind returns one of Assertion* constants
+func (a *Assertion) Kind() string {
+	switch {
+	case a.StatusCodes != nil:
+		return AssertionStatusCodes
+	case a.MaxLatency != 0:
+		return AssertionMaxLatency
+	case a.BodyContains != "":
+		return AssertionBodyContains
+	case a.BodyRegex != "":
+		return AssertionBodyRegex
+	case a.JsonPath != "":
+		return AssertionJsonPath
+	default:
+		return AssertionHeader
+	}
+}
+
+func (a Assertion) MarshalJSON() ([]byte, error) {
+	base := struct {
+		StatusCodes  []int        `json:"status_codes,omitempty"`
+		MaxLatency   float64      `json:"max_latency,omitempty"`
+		BodyContains string       `json:"body_contains,omitempty"`
+		BodyRegex    string       `json:"body_regex,omitempty"`
+		JsonPath     string       `json:"json_path,omitempty"`
+		JsonEquals   *interface{} `json:"equals,omitempty"` // pointer tells unset value from null
+		Header       string       `json:"header,omitempty"`
+	}{
+		StatusCodes:  a.StatusCodes,
+		MaxLatency:   a.MaxLatency.Seconds(),
+		BodyContains: a.BodyContains,
+		BodyRegex:    a.BodyRegex,
+		JsonPath:     a.JsonPath,
+		Header:       a.Header,
+	}
+	if a.JsonPath != "" {
+		base.JsonEquals = &a.JsonEquals
+	}
+	return json.Marshal(base)
+}
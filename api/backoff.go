@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stretching of interval of url which keeps failing (circuit breaker). After Failures consecutive failures
+// the breaker opens - interval is multiplied by Multiplier with each failure (including the one which opened it),
+// up to MaxInterval. The first success closes the breaker and restores configured interval.
+type BackoffPolicy struct {
+	MaxInterval time.Duration // must exceed interval
+	Multiplier  float64       // DefaultBackoffMultiplier if zero
+	Failures    int           // 1 if zero
+}
+
+const DefaultBackoffMultiplier = 2
+
+// Circuit breaker states of url with BackoffPolicy
+const (
+	BreakerClosed = "closed" // url is fetched according to its interval
+	BreakerOpen   = "open"   // url keeps failing, interval is stretched
+)
+
+func (b *BackoffPolicy) UnmarshalJSON(j []byte) error {
+	return unmarshalObject(j, b.fromJsonValue)
+}
+
+func (b *BackoffPolicy) fromJsonValue(value interface{}) error {
+	o, err := parseObject("backoff", value)
+	if err != nil {
+		return err
+	}
+	if err := o.require("max_interval"); err != nil {
+		return err
+	}
+	for key := range o.fields {
+		switch key {
+		case "max_interval":
+			b.MaxInterval, err = o.seconds(key)
+		case "multiplier":
+			b.Multiplier, err = o.number(key, "number greater than 1", func(number float64) bool {
+				return number > 1
+			})
+		case "failures":
+			b.Failures, err = o.integer(key, 1)
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b BackoffPolicy) MarshalJSON() ([]byte, error) {
+	base := struct {
+		MaxInterval float64 `json:"max_interval"`
+		Multiplier  float64 `json:"multiplier,omitempty"`
+		Failures    int     `json:"failures,omitempty"`
+	}{
+		MaxInterval: b.MaxInterval.Seconds(),
+		Multiplier:  b.Multiplier,
+		Failures:    b.Failures,
+	}
+	return json.Marshal(base)
+}
+
+// Interval returns interval stretched after given number of consecutive failures
+func (b BackoffPolicy) Interval(interval time.Duration, consecutiveFailures int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier == 0 {
+		multiplier = DefaultBackoffMultiplier
+	}
+	threshold := b.Failures
+	if threshold == 0 {
+		threshold = 1
+	}
+	stretched := float64(interval)
+	for i := threshold; i <= consecutiveFailures && stretched < float64(b.MaxInterval); i++ {
+		stretched *= multiplier
+	}
+	if stretched > float64(b.MaxInterval) {
+		return b.MaxInterval
+	}
+	return time.Duration(stretched)
+}
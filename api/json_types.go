@@ -1,10 +1,18 @@
 package api
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"mime"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"fetcher/diff"
 )
 
 // Returned by PostNewUrl
@@ -14,69 +22,623 @@ type UrlId struct {
 
 // Request body in PostNewUrl
 type NewUrl struct {
-	Url             *url.URL `json:"url"`
-	IntervalSeconds int      `json:"interval"`
+	Url             *url.URL          `json:"url"`
+	IntervalSeconds int               `json:"interval"`      // zero if Schedule is set
+	Schedule        *Schedule         `json:"schedule"`      // alternative to interval
+	Retention       *RetentionPolicy  `json:"retention"`     // optional, overrides global retention policy
+	Method          string            `json:"method"`        // optional, GET if empty
+	Headers         map[string]string `json:"headers"`       // optional request headers
+	Body            *string           `json:"body"`          // optional request body
+	Timeout         time.Duration     `json:"timeout"`       // optional, must not exceed interval, server default if zero
+	Overlap         string            `json:"overlap"`       // optional, what to do when previous request is in progress, one of Overlap* constants
+	Offset          time.Duration     `json:"offset"`        // optional, time from creation to the first fetch (one interval if zero), must not exceed interval
+	Jitter          time.Duration     `json:"jitter"`        // optional, maximum random delay of each fetch, must be shorter than interval
+	Retry           *RetryPolicy      `json:"retry"`         // optional, failed requests are not retried if nil
+	Backoff         *BackoffPolicy    `json:"backoff"`       // optional, interval is not stretched after failures if nil
+	MaxBodySize     int64             `json:"max_body_size"` // optional, in bytes, longer response bodies are truncated, server default if zero
+	Record          string            `json:"record"`        // optional, which responses are added to history, one of Record* constants
+	Assertions      []Assertion       `json:"assertions"`    // optional, checks of each response which determine health of url
+	Webhooks        []Webhook         `json:"webhooks"`      // optional, receive notifications about changes of url state (besides global ones)
+}
+
+// Overlap policies - what to do on tick when previous request of the same url is still in progress.
+// Skipped ticks are recorded in history as responses with Skipped set. Tick is also skipped (regardless of policy)
+// when request of the previous tick is still waiting for free worker executor.
+const (
+	OverlapAllow = "allow" // start another request (default)
+	OverlapSkip  = "skip"  // skip the tick
+	OverlapQueue = "queue" // start request when the previous one finishes, skip the tick if one is already queued
+)
+
+// Record modes - which responses are added to history. Response which is not added (because it is the same as
+// the newest one in history) increases Unchanged and updates LastSeenAt of the newest response instead.
+const (
+	RecordAll             = "all"                // add every response (default)
+	RecordOnChange        = "on_change"          // add response if its body (or error) differs from the newest one
+	RecordOnChangeOrError = "on_change_or_error" // like RecordOnChange, but add every failed response
+)
+
+// Http methods allowed in NewUrl
+var AllowedMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// Request body in PatchUrl - only given fields are changed
+type UrlPatch struct {
+	Url             *url.URL  `json:"url"`
+	IntervalSeconds *int      `json:"interval"` // replaces schedule
+	Schedule        *Schedule `json:"schedule"` // replaces interval
 }
 
 // Returned by GetAllUrls
 type ReturnedUrl struct {
-	Id          uint64 `json:"id"`
-	UrlAsString string `json:"url"`
-	Interval    int    `json:"interval"`
+	Id          uint64           `json:"id"`
+	UrlAsString string           `json:"url"`
+	Interval    int              `json:"interval,omitempty"`
+	Schedule    *Schedule        `json:"schedule,omitempty"`
+	NextRun     int64            `json:"next_run,omitempty"`  // unix time, zero if fetcher will not run anymore
+	Retention   *RetentionPolicy `json:"retention,omitempty"` // active policy, nil if history is not limited
+	Timeout     float64          `json:"timeout,omitempty"`   // in seconds, zero if server default is used
+	Overlap     string           `json:"overlap,omitempty"`
+	Offset      float64          `json:"offset,omitempty"` // in seconds
+	Jitter      float64          `json:"jitter,omitempty"` // in seconds
+	Retry       *RetryPolicy     `json:"retry,omitempty"`
+	Backoff     *BackoffPolicy   `json:"backoff,omitempty"`
+	// Interval (in seconds) used for the next fetch and state of circuit breaker, only if Backoff is set
+	EffectiveInterval float64           `json:"effective_interval,omitempty"`
+	Breaker           string            `json:"breaker,omitempty"`       // one of Breaker* constants
+	MaxBodySize       int64             `json:"max_body_size,omitempty"` // zero if server default is used
+	Record            string            `json:"record,omitempty"`
+	Assertions        []Assertion       `json:"assertions,omitempty"`
+	Health            string            `json:"health,omitempty"` // one of Health* constants, empty if url was not fetched yet
+	Paused            bool              `json:"paused,omitempty"`
+	Webhooks          []Webhook         `json:"webhooks,omitempty"` // secrets and passwords are redacted
+	Method            string            `json:"method,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"` // values of headers which may contain secrets are redacted
+	Body              *string           `json:"body,omitempty"`
 }
 
+// Returned by GetUrl
+type UrlDetails struct {
+	ReturnedUrl
+	Status UrlStatus `json:"status"`
+}
+
+// Live status of url fetcher
+type UrlStatus struct {
+	NextRun             time.Time // zero if fetcher will not run anymore
+	LastFetch           time.Time // zero if url was not fetched yet
+	LastOutcome         string    // one of Outcome* constants, empty if url was not fetched yet
+	ConsecutiveFailures int
+	TotalFetches        int
+}
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
 // Returned by GetFetcherHistory
 type UrlResponse struct {
-	Response  *string       `json:"response"`
-	Duration  time.Duration `json:"duration"`
-	CreatedAt time.Time     `json:"created_at"`
+	Seq         uint64            `json:"seq"`      // assigned by backend, increasing for each response of given url
+	Response    []byte            `json:"response"` // raw body, nil if url could not be fetched
+	ContentType string            `json:"content_type"`
+	Hash        string            `json:"hash"` // SHA-256 of Response (hex), set by backend, empty if Response is nil
+	Duration    time.Duration     `json:"duration"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StatusCode  int               `json:"status_code"` // 0 if no http response was received
+	Headers     map[string]string `json:"headers"`     // selected response headers
+	Error       FetchError        `json:"error"`       // empty if response was fetched successfully
+	Timeout     time.Duration     `json:"timeout"`     // timeout used for the request
+	Skipped     bool              `json:"skipped"`     // request was not made because of overlap policy or busy executors
+	// Number of requests made (including retries), zero if skipped. Other fields describe the last attempt,
+	// except CreatedAt, which is time of the first one.
+	Attempts         int             `json:"attempts"`
+	AttemptDurations []time.Duration `json:"attempt_durations"` // durations of all attempts, nil if there were no retries
+	// Total size of response body - from Content-Length or number of bytes read if it is unknown (body is not read
+	// after size limit is exceeded, so the size of truncated body may be larger)
+	Size       int64             `json:"size"`
+	Truncated  bool              `json:"truncated"`  // Response contains only the beginning of body, as its size exceeds the limit
+	Assertions []AssertionResult `json:"assertions"` // results of assertions of url, nil if it has none
+	// Number of later fetches with the same outcome which were not added to history (see Record* constants)
+	// and time of the last one, zero if there were none
+	Unchanged  int       `json:"unchanged"`
+	LastSeenAt time.Time `json:"last_seen_at"`
 }
 
+// Encodings of response body in json
+const (
+	EncodingText   = "utf-8"
+	EncodingBase64 = "base64"
+)
+
+// Category of error which caused fetch failure
+type FetchError string
+
+const (
+	FetchErrorTimeout  FetchError = "timeout"
+	FetchErrorDns      FetchError = "dns"
+	FetchErrorConnect  FetchError = "connect"
+	FetchErrorTls      FetchError = "tls"
+	FetchErrorStatus   FetchError = "status" // http status other than 2xx
+	FetchErrorBodyRead FetchError = "body_read"
+	FetchErrorOther    FetchError = "other"
+)
+
+var fetchErrors = []FetchError{FetchErrorTimeout, FetchErrorDns, FetchErrorConnect, FetchErrorTls, FetchErrorStatus, FetchErrorBodyRead, FetchErrorOther}
+
+// Parameters of QueryFetcherHistory - zero value of each field means no filtering
+type HistoryQuery struct {
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+	Limit int
+	After *HistoryCursor // continue from position returned in previous HistoryPage
+	Order string         // HistoryOrderAsc (default) or HistoryOrderDesc
+}
+
+const (
+	HistoryOrderAsc  = "asc"
+	HistoryOrderDesc = "desc"
+)
+
+// Position in history - responses are ordered by CreatedAt and then by Seq
+type HistoryCursor struct {
+	CreatedAt time.Time
+	Seq       uint64
+}
+
+// Returned by QueryFetcherHistory
+type HistoryPage struct {
+	Responses  []UrlResponse  `json:"responses"`
+	NextCursor *HistoryCursor `json:"next_cursor"` // nil if there are no more responses
+}
+
+// Returned by GetFetcherDiff - difference between bodies of two responses of the same url
+// (body of failed response is empty)
+type ResponseDiff struct {
+	From    uint64       `json:"from"` // seq
+	To      uint64       `json:"to"`   // seq
+	Equal   bool         `json:"equal"`
+	Binary  bool         `json:"binary,omitempty"`  // at least one body is not text (see IsText), so only Equal is set
+	Unified string       `json:"unified,omitempty"` // unified diff of bodies, empty if they are equal
+	Json    []JsonChange `json:"json"`              // structural diff, nil unless both bodies are json objects or arrays
+}
+
+// Change of value at Path (in JSONPath notation, e.g. $.items[2].name) between json bodies
+type JsonChange struct {
+	Path string
+	Op   string      // one of JsonChange* constants
+	From interface{} // value decoded by encoding/json, unset if it was added
+	To   interface{} // value decoded by encoding/json, unset if it was removed
+}
+
+const (
+	JsonChangeAdded   = diff.Added
+	JsonChangeRemoved = diff.Removed
+	JsonChangeChanged = diff.Changed
+)
+
 func (n *NewUrl) UnmarshalJSON(j []byte) error {
 	var rawData map[string]interface{}
-	err := json.Unmarshal(j, &rawData)
-	if err != nil {
+	if err := json.Unmarshal(j, &rawData); err != nil {
 		return err
 	}
-	if len(rawData) != 2 {
-		return fmt.Errorf("expected exactly 2 keys: url, interval, got %d in json %s", len(rawData), j)
+	if err := n.fromJsonObject(jsonObject{fields: rawData}); err != nil {
+		return fmt.Errorf("%s in json %s", err, j)
 	}
-	for key, value := range rawData {
-		if key == "url" {
-			urlStr, ok := value.(string)
-			if !ok {
-				return fmt.Errorf("unexpected value for key url (expected url as string, got %v as %T) in json %s", value, value, j)
-			}
-			n.Url, err = url.ParseRequestURI(urlStr)
-			if err != nil {
-				return err
-			}
-		} else if key == "interval" {
-			intervalFloat, ok := value.(float64)
-			if !ok {
-				return fmt.Errorf("unexpected value for key interval (expected number, got %v as %T) in json %s", value, value, j)
-			}
-			n.IntervalSeconds = int(intervalFloat)
-			if float64(n.IntervalSeconds) != intervalFloat {
-				return fmt.Errorf("invalid interval in new url - must be positive integer, got %f", intervalFloat)
+	return n.Validate()
+}
+
+func (n *NewUrl) fromJsonObject(o jsonObject) error {
+	if err := o.require("url"); err != nil {
+		return err
+	}
+	if o.has("interval") == o.has("schedule") {
+		return fmt.Errorf("expected exactly one of keys interval, schedule")
+	}
+	var err error
+	for key, value := range o.fields {
+		switch key {
+		case "url":
+			n.Url, err = parseUrl(o)
+		case "interval":
+			n.IntervalSeconds, err = o.integer(key, 1)
+		case "schedule":
+			n.Schedule = &Schedule{}
+			err = n.Schedule.fromJsonValue(value)
+		case "retention":
+			n.Retention = &RetentionPolicy{}
+			err = n.Retention.fromJsonValue(value)
+		case "method":
+			n.Method, err = o.oneOf(key, AllowedMethods...)
+		case "headers":
+			n.Headers, err = parseHeaders(o)
+		case "body":
+			var body string
+			body, err = o.string(key)
+			n.Body = &body
+		case "timeout":
+			n.Timeout, err = o.seconds(key)
+		case "overlap":
+			n.Overlap, err = o.oneOf(key, OverlapAllow, OverlapSkip, OverlapQueue)
+		case "offset":
+			n.Offset, err = o.seconds(key)
+		case "jitter":
+			n.Jitter, err = o.seconds(key)
+		case "retry":
+			n.Retry = &RetryPolicy{}
+			err = n.Retry.fromJsonValue(value)
+		case "max_body_size":
+			var size int
+			size, err = o.integer(key, 1)
+			n.MaxBodySize = int64(size)
+		case "record":
+			n.Record, err = o.oneOf(key, RecordAll, RecordOnChange, RecordOnChangeOrError)
+		case "webhooks":
+			var values []interface{}
+			values, err = o.array(key)
+			n.Webhooks = make([]Webhook, len(values))
+			for i := 0; i < len(values) && err == nil; i++ {
+				err = n.Webhooks[i].fromJsonValue(values[i])
 			}
-			if n.IntervalSeconds <= 0 {
-				return fmt.Errorf("invalid interval in new url - must be positive integer, got %d", n.IntervalSeconds)
+		case "assertions":
+			var values []interface{}
+			values, err = o.array(key)
+			n.Assertions = make([]Assertion, len(values))
+			for i := 0; i < len(values) && err == nil; i++ {
+				err = n.Assertions[i].fromJsonValue(values[i])
 			}
+		case "backoff":
+			n.Backoff = &BackoffPolicy{}
+			err = n.Backoff.fromJsonValue(value)
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// Validate checks constraints between fields of NewUrl
+func (n *NewUrl) Validate() error {
+	if (n.IntervalSeconds > 0) == (n.Schedule != nil) {
+		return fmt.Errorf("exactly one of interval and schedule must be set")
+	}
+	if n.Schedule != nil {
+		if err := n.Schedule.Validate(); err != nil {
+			return err
+		}
+	}
+	if n.IntervalSeconds > 0 && n.Timeout > time.Duration(n.IntervalSeconds)*time.Second {
+		return fmt.Errorf("timeout %s exceeds interval %ds", n.Timeout, n.IntervalSeconds)
+	}
+	if n.IntervalSeconds > 0 && n.Jitter >= time.Duration(n.IntervalSeconds)*time.Second {
+		return fmt.Errorf("jitter %s is not shorter than interval %ds", n.Jitter, n.IntervalSeconds)
+	}
+	if n.Schedule != nil && n.Offset != 0 {
+		return fmt.Errorf("offset can be used only with interval")
+	}
+	if n.Offset > time.Duration(n.IntervalSeconds)*time.Second {
+		return fmt.Errorf("offset %s exceeds interval %ds", n.Offset, n.IntervalSeconds)
+	}
+	if n.Backoff != nil && n.Schedule != nil {
+		return fmt.Errorf("backoff can be used only with interval")
+	}
+	if n.Backoff != nil && n.Backoff.MaxInterval <= time.Duration(n.IntervalSeconds)*time.Second {
+		return fmt.Errorf("backoff max_interval %s does not exceed interval %ds", n.Backoff.MaxInterval, n.IntervalSeconds)
+	}
+	return nil
+}
+
+func (p *UrlPatch) UnmarshalJSON(j []byte) error {
+	var rawData map[string]interface{}
+	if err := json.Unmarshal(j, &rawData); err != nil {
+		return err
+	}
+	if err := p.fromJsonObject(jsonObject{fields: rawData}); err != nil {
+		return fmt.Errorf("%s in json %s", err, j)
+	}
+	return nil
+}
+
+func (p *UrlPatch) fromJsonObject(o jsonObject) error {
+	if len(o.fields) == 0 {
+		return fmt.Errorf("expected at least one of keys: url, interval, schedule")
+	}
+	if o.has("interval") && o.has("schedule") {
+		return fmt.Errorf("expected at most one of keys interval, schedule")
+	}
+	var err error
+	for key, value := range o.fields {
+		switch key {
+		case "url":
+			p.Url, err = parseUrl(o)
+		case "interval":
+			var interval int
+			interval, err = o.integer(key, 1)
+			p.IntervalSeconds = &interval
+		case "schedule":
+			p.Schedule = &Schedule{}
+			err = p.Schedule.fromJsonValue(value)
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply returns copy of url with fields changed according to patch
+func (p *UrlPatch) Apply(url NewUrl) NewUrl {
+	if p.Url != nil {
+		url.Url = p.Url
+	}
+	if p.IntervalSeconds != nil {
+		url.IntervalSeconds = *p.IntervalSeconds
+		url.Schedule = nil
+	}
+	if p.Schedule != nil {
+		url.Schedule = p.Schedule
+		url.IntervalSeconds = 0
+	}
+	return url
+}
+
+func parseUrl(o jsonObject) (*url.URL, error) {
+	rawUrl, err := o.string("url")
+	if err != nil {
+		return nil, err
+	}
+	return url.ParseRequestURI(rawUrl)
+}
+
+func parseHeaders(o jsonObject) (map[string]string, error) {
+	rawHeaders, err := parseObject("headers", o.fields["headers"])
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(rawHeaders.fields))
+	for name := range rawHeaders.fields {
+		value, err := rawHeaders.string(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid header %q: %q", name, value)
+		}
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+	return headers, nil
+}
+
+// Inverse of UnmarshalJSON, used to persist NewUrl in storage
+func (n NewUrl) MarshalJSON() ([]byte, error) {
+	base := struct {
+		Url             string            `json:"url"`
+		IntervalSeconds int               `json:"interval,omitempty"`
+		Schedule        *Schedule         `json:"schedule,omitempty"`
+		Retention       *RetentionPolicy  `json:"retention,omitempty"`
+		Method          string            `json:"method,omitempty"`
+		Headers         map[string]string `json:"headers,omitempty"`
+		Body            *string           `json:"body,omitempty"`
+		Timeout         float64           `json:"timeout,omitempty"`
+		Overlap         string            `json:"overlap,omitempty"`
+		Offset          float64           `json:"offset,omitempty"`
+		Jitter          float64           `json:"jitter,omitempty"`
+		Retry           *RetryPolicy      `json:"retry,omitempty"`
+		Backoff         *BackoffPolicy    `json:"backoff,omitempty"`
+		MaxBodySize     int64             `json:"max_body_size,omitempty"`
+		Record          string            `json:"record,omitempty"`
+		Assertions      []Assertion       `json:"assertions,omitempty"`
+		Webhooks        []Webhook         `json:"webhooks,omitempty"`
+	}{
+		Url:             n.Url.String(),
+		IntervalSeconds: n.IntervalSeconds,
+		Schedule:        n.Schedule,
+		Retention:       n.Retention,
+		Method:          n.Method,
+		Headers:         n.Headers,
+		Body:            n.Body,
+		Timeout:         n.Timeout.Seconds(),
+		Overlap:         n.Overlap,
+		Offset:          n.Offset.Seconds(),
+		Jitter:          n.Jitter.Seconds(),
+		Retry:           n.Retry,
+		Backoff:         n.Backoff,
+		MaxBodySize:     n.MaxBodySize,
+		Record:          n.Record,
+		Assertions:      n.Assertions,
+		Webhooks:        n.Webhooks,
+	}
+	return json.Marshal(base)
+}
+
+func (c JsonChange) MarshalJSON() ([]byte, error) {
+	base := struct {
+		Path string       `json:"path"`
+		Op   string       `json:"op"`
+		From *interface{} `json:"from,omitempty"` // pointers tell unset value from null
+		To   *interface{} `json:"to,omitempty"`
+	}{
+		Path: c.Path,
+		Op:   c.Op,
+	}
+	if c.Op != JsonChangeAdded {
+		base.From = &c.From
+	}
+	if c.Op != JsonChangeRemoved {
+		base.To = &c.To
+	}
+	return json.Marshal(base)
+}
+
+func (s UrlStatus) MarshalJSON() ([]byte, error) {
+	base := struct {
+		NextRun             *int64  `json:"next_run"`
+		LastFetch           *int64  `json:"last_fetch"`
+		LastOutcome         *string `json:"last_outcome"`
+		ConsecutiveFailures int     `json:"consecutive_failures"`
+		TotalFetches        int     `json:"total_fetches"`
+	}{
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		TotalFetches:        s.TotalFetches,
+	}
+	if !s.NextRun.IsZero() {
+		nextRun := s.NextRun.Unix()
+		base.NextRun = &nextRun
+	}
+	if !s.LastFetch.IsZero() {
+		lastFetch := s.LastFetch.Unix()
+		base.LastFetch = &lastFetch
+	}
+	if s.LastOutcome != "" {
+		base.LastOutcome = &s.LastOutcome
+	}
+	return json.Marshal(base)
+}
+
+func (c HistoryCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", c.CreatedAt.UnixNano(), c.Seq)))
+}
+
+func ParseHistoryCursor(s string) (HistoryCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return HistoryCursor{}, fmt.Errorf("invalid cursor %s: %s", s, err)
+	}
+	var createdAtNanos int64
+	var seq uint64
+	if _, err := fmt.Sscanf(string(decoded), "%d.%d", &createdAtNanos, &seq); err != nil {
+		return HistoryCursor{}, fmt.Errorf("invalid cursor %s: %s", s, err)
+	}
+	return HistoryCursor{CreatedAt: time.Unix(0, createdAtNanos), Seq: seq}, nil
+}
+
+func (c HistoryCursor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
 func (u *UrlResponse) MarshalJSON() ([]byte, error) {
 	base := struct {
-		Response  *string `json:"response"`
-		Duration  float64 `json:"duration"`
-		CreatedAt int64   `json:"created_at"`
+		Seq              uint64            `json:"seq,omitempty"`
+		Response         *string           `json:"response"`
+		Encoding         string            `json:"encoding,omitempty"` // one of Encoding* constants, empty if response is null
+		ContentType      string            `json:"content_type,omitempty"`
+		Hash             string            `json:"hash,omitempty"`
+		Duration         float64           `json:"duration"`
+		CreatedAt        int64             `json:"created_at"`
+		StatusCode       int               `json:"status_code,omitempty"`
+		Headers          map[string]string `json:"headers,omitempty"`
+		Error            FetchError        `json:"error,omitempty"`
+		Timeout          float64           `json:"timeout,omitempty"`
+		Skipped          bool              `json:"skipped,omitempty"`
+		Attempts         int               `json:"attempts,omitempty"`
+		AttemptDurations []float64         `json:"attempt_durations,omitempty"`
+		Size             int64             `json:"size,omitempty"`
+		Truncated        bool              `json:"truncated,omitempty"`
+		Unchanged        int               `json:"unchanged,omitempty"`
+		LastSeenAt       int64             `json:"last_seen_at,omitempty"`
+		Assertions       []AssertionResult `json:"assertions,omitempty"`
 	}{
-		Response:  u.Response,
-		Duration:  u.Duration.Seconds(),
-		CreatedAt: u.CreatedAt.Unix(),
+		Seq:         u.Seq,
+		ContentType: u.ContentType,
+		Hash:        u.Hash,
+		Duration:    u.Duration.Seconds(),
+		CreatedAt:   u.CreatedAt.Unix(),
+		StatusCode:  u.StatusCode,
+		Headers:     u.Headers,
+		Error:       u.Error,
+		Timeout:     u.Timeout.Seconds(),
+		Skipped:     u.Skipped,
+		Attempts:    u.Attempts,
+		Size:        u.Size,
+		Truncated:   u.Truncated,
+		Unchanged:   u.Unchanged,
+		Assertions:  u.Assertions,
+	}
+	if !u.LastSeenAt.IsZero() {
+		base.LastSeenAt = u.LastSeenAt.Unix()
+	}
+	if u.Response != nil {
+		response := string(u.Response)
+		base.Encoding = EncodingText
+		if !IsText(u.ContentType, u.Response) {
+			response = base64.StdEncoding.EncodeToString(u.Response)
+			base.Encoding = EncodingBase64
+		}
+		base.Response = &response
+	}
+	for _, duration := range u.AttemptDurations {
+		base.AttemptDurations = append(base.AttemptDurations, duration.Seconds())
 	}
 	return json.Marshal(base)
 }
+
+// IsText tells whether body can be returned in json as text. Body of media type which is known to be binary
+// is always encoded, other bodies are returned as text if they are valid UTF-8 (without NUL characters).
+func IsText(contentType string, body []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "font/"):
+		return false
+	}
+	for _, binaryType := range binaryMediaTypes {
+		if mediaType == binaryType {
+			return false
+		}
+	}
+	return utf8.Valid(body) && bytes.IndexByte(body, 0) < 0
+}
+
+var binaryMediaTypes = []string{
+	"application/octet-stream",
+	"application/gzip",
+	"application/zip",
+	"application/pdf",
+	"application/protobuf",
+	"application/x-protobuf",
+	"application/grpc",
+	"application/msgpack",
+	"application/cbor",
+}
+
+// Returned by WorkerStatsSource
+type WorkerStats struct {
+	Executors  int     `json:"executors"`
+	Busy       int     `json:"busy"`        // executors making requests
+	Saturation float64 `json:"saturation"`  // Busy / Executors
+	QueueDepth int     `json:"queue_depth"` // requests waiting for free executor
+	Fetchers   int     `json:"fetchers"`
+}
+
+// Parameters of Backend.Subscribe
+type StreamQuery struct {
+	UrlId       *uint64 // nil to receive responses of all urls
+	LastEventId *uint64 // resume stream after event with given id (see StreamEvent.Id)
+}
+
+// Event received from Subscription
+type StreamEvent struct {
+	Id       uint64      // seq of response in stream of single url, number of event (counted since server start) in stream of all urls
+	UrlId    uint64      //
+	Response UrlResponse // zero if Reset is set
+	Reset    bool        // events after requested LastEventId are not available - client should reload history instead
+}
+
+// Returned by Backend.Subscribe. Events is closed when subscriber does not keep up with events (it should subscribe again
+// with LastEventId) or when url is deleted. Cancel must be called when subscriber stops reading events.
+type Subscription struct {
+	Events <-chan StreamEvent
+	Cancel func()
+}
@@ -3,6 +3,7 @@ package api_test
 import (
 	"encoding/json"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 )
 
 // Tests cover only API use cases, for example NewUrl is used as response body in PostNewUrl, so there is only Unmarshal
+// (Marshal of NewUrl is needed only to persist it in storage)
 func TestJsonMarshalling(t *testing.T) {
 	t.Run("Marshal UrlId", func(t *testing.T) {
 		bytes, err := json.Marshal(api.UrlId{Id: 2})
@@ -29,6 +31,211 @@ func TestJsonMarshalling(t *testing.T) {
 			require.NoError(t, json.Unmarshal(data, &newUrl))
 			assert.Equal(t, api.NewUrl{Url: expectedUrl, IntervalSeconds: 60}, newUrl)
 		})
+		t.Run("with valid json with retention", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"retention":{"max_entries":10,"max_age":1.5,"max_bytes":1000}}`)
+			expectedUrl, err := url.Parse("https://httpbin.org/range/15")
+			require.NoError(t, err)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			expectedRetention := &api.RetentionPolicy{MaxEntries: 10, MaxAge: 1500 * time.Millisecond, MaxBytes: 1000}
+			assert.Equal(t, api.NewUrl{Url: expectedUrl, IntervalSeconds: 60, Retention: expectedRetention}, newUrl)
+		})
+		t.Run("with valid json with method, headers and body", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/post","interval":60,"method":"POST","headers":{"content-type":"application/json"},"body":"{}"}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			assert.Equal(t, "POST", newUrl.Method)
+			assert.Equal(t, map[string]string{"Content-Type": "application/json"}, newUrl.Headers)
+			require.NotNil(t, newUrl.Body)
+			assert.Equal(t, "{}", *newUrl.Body)
+		})
+		t.Run("with invalid method, headers or body", func(t *testing.T) {
+			for _, keyValue := range []string{`"method":"FETCH"`, `"method":1`, `"headers":[]`, `"headers":{"a":1}`,
+				`"headers":{"a b":"c"}`, `"headers":{"a":"b\r\nc: d"}`, `"body":{}`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,` + keyValue + `}`)
+				var newUrl api.NewUrl
+				assert.Error(t, json.Unmarshal(data, &newUrl), keyValue)
+			}
+		})
+		t.Run("with valid json with cron schedule", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","schedule":{"cron":"*/5 9-17 * * MON-FRI","timezone":"Europe/Warsaw"}}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			assert.Equal(t, 0, newUrl.IntervalSeconds)
+			assert.Equal(t, &api.Schedule{Cron: "*/5 9-17 * * MON-FRI", TimeZone: "Europe/Warsaw"}, newUrl.Schedule)
+		})
+		t.Run("with valid json with one-shot schedule", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","schedule":{"at":1598247073}}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			require.NotNil(t, newUrl.Schedule)
+			assert.Equal(t, time.Unix(1598247073, 0), newUrl.Schedule.At)
+		})
+		t.Run("with invalid schedule", func(t *testing.T) {
+			for _, keyValue := range []string{`"interval":60,"schedule":{"cron":"* * * * *"}`, `"schedule":{}`, `"schedule":"* * * * *"`,
+				`"schedule":{"cron":"* * * *"}`, `"schedule":{"cron":"* * * * *","timezone":"Mars/Olympus"}`,
+				`"schedule":{"cron":"* * * * *","at":1598247073}`, `"schedule":{"at":1598247073,"timezone":"UTC"}`,
+				`"schedule":{"at":"tomorrow"}`, `"schedule":{"cron":"* * * * *","every":5}`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15",` + keyValue + `}`)
+				var newUrl api.NewUrl
+				assert.Error(t, json.Unmarshal(data, &newUrl), keyValue)
+			}
+		})
+		t.Run("with valid json with offset and jitter", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"offset":10,"jitter":2.5}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			assert.Equal(t, 10*time.Second, newUrl.Offset)
+			assert.Equal(t, 2500*time.Millisecond, newUrl.Jitter)
+		})
+		t.Run("with invalid offset or jitter", func(t *testing.T) {
+			for _, keyValue := range []string{`"interval":60,"offset":0`, `"interval":60,"jitter":-1`, `"interval":60,"offset":"10"`,
+				`"interval":60,"offset":61`, `"interval":60,"jitter":60`, `"schedule":{"cron":"@hourly"},"offset":10`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15",` + keyValue + `}`)
+				var newUrl api.NewUrl
+				assert.Error(t, json.Unmarshal(data, &newUrl), keyValue)
+			}
+		})
+		t.Run("with valid json with retry", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"retry":{"max_attempts":3,"base_delay":0.5,"max_delay":4,` +
+				`"status_codes":[429,503],"errors":["timeout","dns"]}}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			expectedRetry := &api.RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 4 * time.Second,
+				StatusCodes: []int{429, 503}, Errors: []api.FetchError{api.FetchErrorTimeout, api.FetchErrorDns}}
+			assert.Equal(t, expectedRetry, newUrl.Retry)
+		})
+		t.Run("with invalid retry", func(t *testing.T) {
+			for _, retry := range []string{`3`, `{"max_attempts":3}`, `{"base_delay":1}`, `{"max_attempts":0,"base_delay":1}`,
+				`{"max_attempts":1.5,"base_delay":1}`, `{"max_attempts":3,"base_delay":0}`, `{"max_attempts":3,"base_delay":2,"max_delay":1}`,
+				`{"max_attempts":3,"base_delay":1,"status_codes":[200]}`, `{"max_attempts":3,"base_delay":1,"status_codes":[204]}`, `{"max_attempts":3,"base_delay":1,"status_codes":503}`,
+				`{"max_attempts":3,"base_delay":1,"errors":["status"]}`, `{"max_attempts":3,"base_delay":1,"errors":["oops"]}`,
+				`{"max_attempts":3,"base_delay":1,"jitter":1}`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"retry":` + retry + `}`)
+				var newUrl api.NewUrl
+				assert.Error(t, json.Unmarshal(data, &newUrl), retry)
+			}
+		})
+		t.Run("with valid json with backoff", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"backoff":{"max_interval":600,"multiplier":1.5,"failures":3}}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			assert.Equal(t, &api.BackoffPolicy{MaxInterval: 10 * time.Minute, Multiplier: 1.5, Failures: 3}, newUrl.Backoff)
+		})
+		t.Run("with invalid backoff", func(t *testing.T) {
+			for _, keyValue := range []string{`"interval":60,"backoff":600`, `"interval":60,"backoff":{"multiplier":2}`,
+				`"interval":60,"backoff":{"max_interval":60}`, `"interval":60,"backoff":{"max_interval":600,"multiplier":1}`,
+				`"interval":60,"backoff":{"max_interval":600,"failures":0.5}`, `"interval":60,"backoff":{"max_interval":600,"cap":1}`,
+				`"schedule":{"cron":"@hourly"},"backoff":{"max_interval":600}`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15",` + keyValue + `}`)
+				var newUrl api.NewUrl
+				assert.Error(t, json.Unmarshal(data, &newUrl), keyValue)
+			}
+		})
+		t.Run("with max body size", func(t *testing.T) {
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal([]byte(`{"url":"https://httpbin.org/range/15","interval":60,"max_body_size":1024}`), &newUrl))
+			assert.Equal(t, int64(1024), newUrl.MaxBodySize)
+			for _, size := range []string{`0`, `-1`, `1.5`, `"1kB"`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"max_body_size":` + size + `}`)
+				assert.Error(t, json.Unmarshal(data, &newUrl), size)
+			}
+		})
+		t.Run("with valid json with timeout", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","interval":1,"timeout":0.25}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			assert.Equal(t, 250*time.Millisecond, newUrl.Timeout)
+		})
+		t.Run("with overlap", func(t *testing.T) {
+			for _, overlap := range []string{api.OverlapAllow, api.OverlapSkip, api.OverlapQueue} {
+				data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"overlap":"` + overlap + `"}`)
+				var newUrl api.NewUrl
+				require.NoError(t, json.Unmarshal(data, &newUrl))
+				assert.Equal(t, overlap, newUrl.Overlap)
+			}
+			var newUrl api.NewUrl
+			assert.Error(t, json.Unmarshal([]byte(`{"url":"https://httpbin.org/range/15","interval":60,"overlap":"never"}`), &newUrl))
+		})
+		t.Run("with assertions", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/json","interval":60,"assertions":[{"status_codes":[200,204]},{"max_latency":0.5},` +
+				`{"body_contains":"up"},{"body_regex":"^v\\d"},{"json_path":"$.a[0]","equals":null},{"header":"etag"}]}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			expected := []api.Assertion{
+				{StatusCodes: []int{200, 204}},
+				{MaxLatency: 500 * time.Millisecond},
+				{BodyContains: "up"},
+				{BodyRegex: `^v\d`},
+				{JsonPath: "$.a[0]"},
+				{Header: "Etag"},
+			}
+			assert.Equal(t, expected, newUrl.Assertions)
+			for _, assertion := range []string{
+				`{}`,
+				`{"status_codes":[]}`,
+				`{"status_codes":[99]}`,
+				`{"max_latency":0}`,
+				`{"body_contains":""}`,
+				`{"body_regex":"("}`,
+				`{"json_path":"$.a"}`,
+				`{"json_path":"a","equals":1}`,
+				`{"equals":1}`,
+				`{"header":"Etag","body_contains":"up"}`,
+				`{"unknown":1}`,
+				`"status"`,
+			} {
+				data := []byte(`{"url":"https://httpbin.org/json","interval":60,"assertions":[` + assertion + `]}`)
+				assert.Error(t, json.Unmarshal(data, &newUrl), assertion)
+			}
+		})
+		t.Run("with webhooks", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/json","interval":60,"webhooks":[{"url":"https://hooks.example.com/a"},{"url":"http://localhost:9000/hook","secret":"s3cret"}]}`)
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal(data, &newUrl))
+			require.Len(t, newUrl.Webhooks, 2)
+			assert.Equal(t, "https://hooks.example.com/a", newUrl.Webhooks[0].Url.String())
+			assert.Empty(t, newUrl.Webhooks[0].Secret)
+			assert.Equal(t, "http://localhost:9000/hook", newUrl.Webhooks[1].Url.String())
+			assert.Equal(t, "s3cret", newUrl.Webhooks[1].Secret)
+			for _, webhook := range []string{
+				`{}`,
+				`{"secret":"s3cret"}`,
+				`{"url":"ftp://hooks.example.com/a"}`,
+				`{"url":"/hook"}`,
+				`{"url":"https://hooks.example.com/a","secret":""}`,
+				`{"url":"https://hooks.example.com/a","unknown":"a"}`,
+				`"https://hooks.example.com/a"`,
+			} {
+				data := []byte(`{"url":"https://httpbin.org/json","interval":60,"webhooks":[` + webhook + `]}`)
+				assert.Error(t, json.Unmarshal(data, &newUrl), webhook)
+			}
+		})
+		t.Run("with record mode", func(t *testing.T) {
+			for _, record := range []string{api.RecordAll, api.RecordOnChange, api.RecordOnChangeOrError} {
+				data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"record":"` + record + `"}`)
+				var newUrl api.NewUrl
+				require.NoError(t, json.Unmarshal(data, &newUrl))
+				assert.Equal(t, record, newUrl.Record)
+			}
+			var newUrl api.NewUrl
+			assert.Error(t, json.Unmarshal([]byte(`{"url":"https://httpbin.org/range/15","interval":60,"record":"on_error"}`), &newUrl))
+			assert.Error(t, json.Unmarshal([]byte(`{"url":"https://httpbin.org/range/15","interval":60,"record":true}`), &newUrl))
+		})
+		t.Run("with invalid timeout", func(t *testing.T) {
+			for _, timeout := range []string{`"1"`, `0`, `-1`, `60.5`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"timeout":` + timeout + `}`)
+				var newUrl api.NewUrl
+				assert.Error(t, json.Unmarshal(data, &newUrl), timeout)
+			}
+		})
+		t.Run("with invalid retention", func(t *testing.T) {
+			for _, retention := range []string{`5`, `{"max_entries":-1}`, `{"max_entries":1.5}`, `{"max_bytes":"5"}`, `{"key":5}`} {
+				data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"retention":` + retention + `}`)
+				var newUrl api.NewUrl
+				assert.Error(t, json.Unmarshal(data, &newUrl), retention)
+			}
+		})
 		t.Run("with invalid json syntax", func(t *testing.T) {
 			data := []byte(`{"url":"https://httpbin.org/range/15","interval":60`)
 			var newUrl api.NewUrl
@@ -64,6 +271,82 @@ func TestJsonMarshalling(t *testing.T) {
 			var newUrl api.NewUrl
 			assert.Error(t, json.Unmarshal(data, &newUrl))
 		})
+		t.Run("error names invalid key of nested object", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","interval":60,"retry":{"max_attempts":3,"base_delay":"1"}}`)
+			var newUrl api.NewUrl
+			err := json.Unmarshal(data, &newUrl)
+			require.Error(t, err)
+			assert.True(t, strings.HasPrefix(err.Error(), "unexpected value for retry key base_delay (expected positive number of seconds, got 1 as string) in json {"), err.Error())
+		})
+	})
+
+	t.Run("Unmarshal UrlPatch", func(t *testing.T) {
+		t.Run("with url and interval", func(t *testing.T) {
+			data := []byte(`{"url":"https://httpbin.org/range/15","interval":60}`)
+			expectedUrl, err := url.Parse("https://httpbin.org/range/15")
+			require.NoError(t, err)
+			var patch api.UrlPatch
+			require.NoError(t, json.Unmarshal(data, &patch))
+			interval := 60
+			assert.Equal(t, api.UrlPatch{Url: expectedUrl, IntervalSeconds: &interval}, patch)
+		})
+		t.Run("with interval only", func(t *testing.T) {
+			data := []byte(`{"interval":60}`)
+			var patch api.UrlPatch
+			require.NoError(t, json.Unmarshal(data, &patch))
+			assert.Nil(t, patch.Url)
+			require.NotNil(t, patch.IntervalSeconds)
+			assert.Equal(t, 60, *patch.IntervalSeconds)
+		})
+		t.Run("with schedule", func(t *testing.T) {
+			var patch api.UrlPatch
+			require.NoError(t, json.Unmarshal([]byte(`{"schedule":{"cron":"@hourly"}}`), &patch))
+			assert.Equal(t, &api.Schedule{Cron: "@hourly"}, patch.Schedule)
+			patched := patch.Apply(api.NewUrl{IntervalSeconds: 60})
+			assert.Equal(t, api.NewUrl{Schedule: &api.Schedule{Cron: "@hourly"}}, patched)
+		})
+		t.Run("with both interval and schedule", func(t *testing.T) {
+			var patch api.UrlPatch
+			assert.Error(t, json.Unmarshal([]byte(`{"interval":60,"schedule":{"cron":"@hourly"}}`), &patch))
+		})
+		t.Run("with no keys", func(t *testing.T) {
+			var patch api.UrlPatch
+			assert.Error(t, json.Unmarshal([]byte(`{}`), &patch))
+		})
+		t.Run("with invalid interval", func(t *testing.T) {
+			var patch api.UrlPatch
+			assert.Error(t, json.Unmarshal([]byte(`{"interval":0}`), &patch))
+		})
+		t.Run("with unexpected json key", func(t *testing.T) {
+			var patch api.UrlPatch
+			assert.Error(t, json.Unmarshal([]byte(`{"interval":60,"retention":{}}`), &patch))
+		})
+	})
+
+	t.Run("Marshal NewUrl", func(t *testing.T) {
+		for _, data := range []string{
+			`{"url":"https://httpbin.org/range/15","interval":60}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"retention":{"max_entries":10,"max_age":1.5}}`,
+			`{"url":"https://httpbin.org/post","interval":60,"method":"POST","headers":{"Accept":"*/*"},"body":"abc"}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"timeout":2.5,"overlap":"skip"}`,
+			`{"url":"https://httpbin.org/range/15","schedule":{"cron":"0 9 * * *","timezone":"Europe/Warsaw"}}`,
+			`{"url":"https://httpbin.org/range/15","schedule":{"at":1598247073}}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"offset":10,"jitter":0.5}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"retry":{"max_attempts":3,"base_delay":0.5}}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"backoff":{"max_interval":600}}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"max_body_size":1024}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"record":"on_change"}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"webhooks":[{"url":"https://hooks.example.com/a"},{"url":"https://hooks.example.com/b","secret":"s3cret"}]}`,
+			`{"url":"https://httpbin.org/json","interval":60,"assertions":[{"status_codes":[200]},{"max_latency":0.5},{"json_path":"$.a","equals":{"b":[1,null]}},{"json_path":"$.b","equals":null},{"header":"Etag"}]}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"backoff":{"max_interval":600,"multiplier":1.5,"failures":3}}`,
+			`{"url":"https://httpbin.org/range/15","interval":60,"retry":{"max_attempts":3,"base_delay":1,"max_delay":8,"status_codes":[],"errors":["dns"]}}`,
+		} {
+			var newUrl api.NewUrl
+			require.NoError(t, json.Unmarshal([]byte(data), &newUrl))
+			bytes, err := json.Marshal(newUrl)
+			require.NoError(t, err)
+			assert.Equal(t, data, string(bytes))
+		}
 	})
 
 	t.Run("Marshal ReturnedUrl", func(t *testing.T) {
@@ -72,17 +355,182 @@ func TestJsonMarshalling(t *testing.T) {
 		assert.Equal(t, `{"id":11,"url":"https://httpbin.org/range/15","interval":60}`, string(bytes))
 	})
 
+	t.Run("Marshal ReturnedUrl with retention", func(t *testing.T) {
+		retention := &api.RetentionPolicy{MaxEntries: 5, MaxAge: time.Hour}
+		bytes, err := json.Marshal(api.ReturnedUrl{Id: 11, UrlAsString: "https://httpbin.org/range/15", Interval: 60, Retention: retention})
+		require.NoError(t, err)
+		assert.Equal(t, `{"id":11,"url":"https://httpbin.org/range/15","interval":60,"retention":{"max_entries":5,"max_age":3600}}`, string(bytes))
+	})
+
+	t.Run("Marshal ReturnedUrl with schedule and next run", func(t *testing.T) {
+		returnedUrl := api.ReturnedUrl{Id: 11, UrlAsString: "https://httpbin.org/range/15", Schedule: &api.Schedule{Cron: "@daily"}, NextRun: 1598313600}
+		bytes, err := json.Marshal(returnedUrl)
+		require.NoError(t, err)
+		assert.Equal(t, `{"id":11,"url":"https://httpbin.org/range/15","schedule":{"cron":"@daily"},"next_run":1598313600}`, string(bytes))
+	})
+
+	t.Run("Marshal ReturnedUrl with backoff", func(t *testing.T) {
+		returnedUrl := api.ReturnedUrl{Id: 11, UrlAsString: "https://httpbin.org/range/15", Interval: 60,
+			Backoff: &api.BackoffPolicy{MaxInterval: time.Hour}, EffectiveInterval: 240, Breaker: api.BreakerOpen}
+		bytes, err := json.Marshal(returnedUrl)
+		require.NoError(t, err)
+		expected := `{"id":11,"url":"https://httpbin.org/range/15","interval":60,"backoff":{"max_interval":3600},` +
+			`"effective_interval":240,"breaker":"open"}`
+		assert.Equal(t, expected, string(bytes))
+	})
+
+	t.Run("HistoryCursor is parsed from its string representation", func(t *testing.T) {
+		cursor := api.HistoryCursor{CreatedAt: time.Unix(1559034638, 571), Seq: 12}
+		parsed, err := api.ParseHistoryCursor(cursor.String())
+		require.NoError(t, err)
+		assert.True(t, cursor.CreatedAt.Equal(parsed.CreatedAt))
+		assert.Equal(t, cursor.Seq, parsed.Seq)
+		_, err = api.ParseHistoryCursor("xyz")
+		assert.Error(t, err)
+	})
+
+	t.Run("Marshal UrlDetails", func(t *testing.T) {
+		t.Run("of url which was not fetched yet", func(t *testing.T) {
+			details := api.UrlDetails{
+				ReturnedUrl: api.ReturnedUrl{Id: 11, UrlAsString: "https://httpbin.org/range/15", Interval: 60},
+				Status:      api.UrlStatus{NextRun: time.Unix(1559034698, 0)},
+			}
+			bytes, err := json.Marshal(details)
+			require.NoError(t, err)
+			expected := `{"id":11,"url":"https://httpbin.org/range/15","interval":60,"status":{"next_run":1559034698,` +
+				`"last_fetch":null,"last_outcome":null,"consecutive_failures":0,"total_fetches":0}}`
+			assert.Equal(t, expected, string(bytes))
+		})
+		t.Run("of url which will not run anymore", func(t *testing.T) {
+			details := api.UrlDetails{
+				ReturnedUrl: api.ReturnedUrl{Id: 11, UrlAsString: "https://httpbin.org/range/15", Schedule: &api.Schedule{At: time.Unix(1559034638, 0)}},
+				Status:      api.UrlStatus{LastFetch: time.Unix(1559034638, 0), LastOutcome: api.OutcomeSuccess, TotalFetches: 1},
+			}
+			bytes, err := json.Marshal(details)
+			require.NoError(t, err)
+			expected := `{"id":11,"url":"https://httpbin.org/range/15","schedule":{"at":1559034638},"status":{"next_run":null,` +
+				`"last_fetch":1559034638,"last_outcome":"success","consecutive_failures":0,"total_fetches":1}}`
+			assert.Equal(t, expected, string(bytes))
+		})
+	})
+
 	t.Run("Marshal UrlResponse", func(t *testing.T) {
 		t.Run("with non-empty response", func(t *testing.T) {
 			responseStr := "abcd"
 			urlResponse := api.UrlResponse{
-				Response:  &responseStr,
+				Response:  []byte(responseStr),
+				Duration:  time.Duration(int64(0.571 * float64(time.Second))),
+				CreatedAt: time.Unix(1559034638, 0),
+			}
+			bytes, err := json.Marshal(&urlResponse)
+			require.NoError(t, err)
+			assert.Equal(t, `{"response":"abcd","encoding":"utf-8","duration":0.571,"created_at":1559034638}`, string(bytes))
+		})
+		t.Run("with seq", func(t *testing.T) {
+			urlResponse := api.UrlResponse{
+				Seq:       7,
+				Response:  nil,
 				Duration:  time.Duration(int64(0.571 * float64(time.Second))),
 				CreatedAt: time.Unix(1559034638, 0),
 			}
 			bytes, err := json.Marshal(&urlResponse)
 			require.NoError(t, err)
-			assert.Equal(t, `{"response":"abcd","duration":0.571,"created_at":1559034638}`, string(bytes))
+			assert.Equal(t, `{"seq":7,"response":null,"duration":0.571,"created_at":1559034638}`, string(bytes))
+		})
+		t.Run("with status code, headers and error", func(t *testing.T) {
+			urlResponse := api.UrlResponse{
+				Response:   nil,
+				Duration:   time.Duration(int64(0.571 * float64(time.Second))),
+				CreatedAt:  time.Unix(1559034638, 0),
+				StatusCode: 404,
+				Headers:    map[string]string{"Content-Type": "text/plain"},
+				Error:      api.FetchErrorStatus,
+				Timeout:    1500 * time.Millisecond,
+			}
+			bytes, err := json.Marshal(&urlResponse)
+			require.NoError(t, err)
+			expected := `{"response":null,"duration":0.571,"created_at":1559034638,"status_code":404,` +
+				`"headers":{"Content-Type":"text/plain"},"error":"status","timeout":1.5}`
+			assert.Equal(t, expected, string(bytes))
+		})
+		t.Run("with retries", func(t *testing.T) {
+			responseStr := "abcd"
+			urlResponse := api.UrlResponse{
+				Response:         []byte(responseStr),
+				Duration:         250 * time.Millisecond,
+				CreatedAt:        time.Unix(1559034638, 0),
+				StatusCode:       200,
+				Attempts:         2,
+				AttemptDurations: []time.Duration{1500 * time.Millisecond, 250 * time.Millisecond},
+			}
+			bytes, err := json.Marshal(&urlResponse)
+			require.NoError(t, err)
+			expected := `{"response":"abcd","encoding":"utf-8","duration":0.25,"created_at":1559034638,"status_code":200,"attempts":2,"attempt_durations":[1.5,0.25]}`
+			assert.Equal(t, expected, string(bytes))
+		})
+		t.Run("with truncated response", func(t *testing.T) {
+			responseStr := "abcd"
+			urlResponse := api.UrlResponse{
+				Response:  []byte(responseStr),
+				Duration:  250 * time.Millisecond,
+				CreatedAt: time.Unix(1559034638, 0),
+				Size:      1000,
+				Truncated: true,
+			}
+			bytes, err := json.Marshal(&urlResponse)
+			require.NoError(t, err)
+			assert.Equal(t, `{"response":"abcd","encoding":"utf-8","duration":0.25,"created_at":1559034638,"size":1000,"truncated":true}`, string(bytes))
+		})
+		t.Run("with assertion results", func(t *testing.T) {
+			urlResponse := api.UrlResponse{
+				Response:   []byte("abcd"),
+				CreatedAt:  time.Unix(1559034638, 0),
+				Assertions: []api.AssertionResult{{Passed: true}, {Passed: false, Message: "header Etag is missing"}},
+			}
+			bytes, err := json.Marshal(&urlResponse)
+			require.NoError(t, err)
+			expected := `{"response":"abcd","encoding":"utf-8","duration":0,"created_at":1559034638,` +
+				`"assertions":[{"passed":true},{"passed":false,"message":"header Etag is missing"}]}`
+			assert.Equal(t, expected, string(bytes))
+		})
+		t.Run("with unchanged fetches", func(t *testing.T) {
+			urlResponse := api.UrlResponse{
+				Response:   []byte("abcd"),
+				CreatedAt:  time.Unix(1559034638, 0),
+				Unchanged:  3,
+				LastSeenAt: time.Unix(1559034668, 0),
+			}
+			bytes, err := json.Marshal(&urlResponse)
+			require.NoError(t, err)
+			assert.Equal(t, `{"response":"abcd","encoding":"utf-8","duration":0,"created_at":1559034638,"unchanged":3,"last_seen_at":1559034668}`, string(bytes))
+		})
+		t.Run("with hash", func(t *testing.T) {
+			urlResponse := api.UrlResponse{
+				Response:  []byte("abcd"),
+				Hash:      "88d4266fd4e6338d13b845fcf289579d209c897823b9217da3e161936f031589",
+				CreatedAt: time.Unix(1559034638, 0),
+			}
+			bytes, err := json.Marshal(&urlResponse)
+			require.NoError(t, err)
+			assert.Equal(t, `{"response":"abcd","encoding":"utf-8","hash":"88d4266fd4e6338d13b845fcf289579d209c897823b9217da3e161936f031589","duration":0,"created_at":1559034638}`, string(bytes))
+		})
+		t.Run("with binary response", func(t *testing.T) {
+			for _, c := range []struct {
+				body        []byte
+				contentType string
+				expected    string
+			}{
+				{body: []byte{0x1f, 0x8b, 0x08, 0x00}, expected: `"response":"H4sIAA==","encoding":"base64"`},
+				{body: []byte("ab\x00c"), contentType: "text/plain", expected: `"response":"YWIAYw==","encoding":"base64","content_type":"text/plain"`},
+				{body: []byte("GIF89a"), contentType: "image/gif", expected: `"response":"R0lGODlh","encoding":"base64","content_type":"image/gif"`},
+				{body: []byte("zażółć"), contentType: "text/plain; charset=utf-8", expected: `"response":"zażółć","encoding":"utf-8","content_type":"text/plain; charset=utf-8"`},
+				{body: []byte{}, contentType: "application/json", expected: `"response":"","encoding":"utf-8","content_type":"application/json"`},
+			} {
+				urlResponse := api.UrlResponse{Response: c.body, ContentType: c.contentType, CreatedAt: time.Unix(1559034638, 0)}
+				bytes, err := json.Marshal(&urlResponse)
+				require.NoError(t, err)
+				assert.Equal(t, `{`+c.expected+`,"duration":0,"created_at":1559034638}`, string(bytes))
+			}
 		})
 		t.Run("with empty response", func(t *testing.T) {
 			urlResponse := api.UrlResponse{
@@ -96,3 +544,46 @@ func TestJsonMarshalling(t *testing.T) {
 		})
 	})
 }
+
+func TestNotificationMarshalling(t *testing.T) {
+	t.Run("Marshal Notification", func(t *testing.T) {
+		notification := api.Notification{
+			Event:        api.EventChanged,
+			UrlId:        3,
+			Url:          "https://httpbin.org/uuid",
+			Seq:          12,
+			CreatedAt:    time.Unix(1559034638, 0),
+			StatusCode:   200,
+			Hash:         "b",
+			PreviousHash: "a",
+		}
+		bytes, err := json.Marshal(notification)
+		require.NoError(t, err)
+		assert.Equal(t, `{"event":"body_changed","url_id":3,"url":"https://httpbin.org/uuid","seq":12,"created_at":1559034638,"status_code":200,"hash":"b","previous_hash":"a"}`, string(bytes))
+	})
+	t.Run("Marshal Delivery", func(t *testing.T) {
+		delivery := api.Delivery{Id: 1, UrlId: 3, Event: api.EventDown, Webhook: "https://hooks.example.com/a", Status: api.DeliveryPending, CreatedAt: time.Unix(1559034638, 0)}
+		bytes, err := json.Marshal(delivery)
+		require.NoError(t, err)
+		assert.Equal(t, `{"id":1,"url_id":3,"event":"down","webhook":"https://hooks.example.com/a","status":"pending","attempts":0,"created_at":1559034638,"last_attempt":null}`, string(bytes))
+
+		delivery.Status, delivery.Attempts, delivery.StatusCode, delivery.Error = api.DeliveryFailed, 2, 500, "webhook responded with status 500"
+		delivery.LastAttempt = time.Unix(1559034640, 0)
+		bytes, err = json.Marshal(delivery)
+		require.NoError(t, err)
+		assert.Equal(t, `{"id":1,"url_id":3,"event":"down","webhook":"https://hooks.example.com/a","status":"failed","attempts":2,"status_code":500,`+
+			`"error":"webhook responded with status 500","created_at":1559034638,"last_attempt":1559034640}`, string(bytes))
+	})
+}
+
+func TestBackoffPolicyInterval(t *testing.T) {
+	policy := api.BackoffPolicy{MaxInterval: time.Hour, Multiplier: 3, Failures: 2}
+	assert.Equal(t, time.Minute, policy.Interval(time.Minute, 0))
+	assert.Equal(t, time.Minute, policy.Interval(time.Minute, 1))
+	assert.Equal(t, 3*time.Minute, policy.Interval(time.Minute, 2))
+	assert.Equal(t, 27*time.Minute, policy.Interval(time.Minute, 4))
+	assert.Equal(t, time.Hour, policy.Interval(time.Minute, 5))
+	assert.Equal(t, time.Hour, policy.Interval(time.Minute, 1000))
+	defaultPolicy := api.BackoffPolicy{MaxInterval: time.Hour}
+	assert.Equal(t, 2*time.Minute, defaultPolicy.Interval(time.Minute, 1))
+}
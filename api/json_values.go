@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jsonObject is json object decoded by encoding/json. Its methods parse values of keys and return errors which
+// name the object and the key, so that all types decoded from json report invalid values the same way.
+type jsonObject struct {
+	name   string // e.g. "retry" for RetryPolicy, empty for NewUrl and UrlPatch
+	fields map[string]interface{}
+}
+
+// unmarshalObject decodes json and passes it to fromJsonValue of type nested in NewUrl
+func unmarshalObject(j []byte, fromJsonValue func(interface{}) error) error {
+	var rawData interface{}
+	if err := json.Unmarshal(j, &rawData); err != nil {
+		return err
+	}
+	return fromJsonValue(rawData)
+}
+
+// parseObject checks that value decoded by encoding/json is object
+func parseObject(name string, value interface{}) (jsonObject, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return jsonObject{}, fmt.Errorf("unexpected value for %s (expected object, got %v as %T)", name, value, value)
+	}
+	return jsonObject{name: name, fields: fields}, nil
+}
+
+// describe returns name of key in error messages
+func (o jsonObject) describe(key string) string {
+	if o.name == "" {
+		return "key " + key
+	}
+	return o.name + " key " + key
+}
+
+func (o jsonObject) has(key string) bool {
+	_, ok := o.fields[key]
+	return ok
+}
+
+// require fails if any of given keys is missing
+func (o jsonObject) require(keys ...string) error {
+	for _, key := range keys {
+		if !o.has(key) {
+			return fmt.Errorf("missing %s", o.describe(key))
+		}
+	}
+	return nil
+}
+
+func (o jsonObject) unexpectedKey(key string) error {
+	return fmt.Errorf("unexpected %s", o.describe(key))
+}
+
+// invalid returns error for value of key which is not what was expected
+func (o jsonObject) invalid(key string, expected string) error {
+	value := o.fields[key]
+	return fmt.Errorf("unexpected value for %s (expected %s, got %v as %T)", o.describe(key), expected, value, value)
+}
+
+func (o jsonObject) string(key string) (string, error) {
+	str, ok := o.fields[key].(string)
+	if !ok {
+		return "", o.invalid(key, "string")
+	}
+	return str, nil
+}
+
+func (o jsonObject) nonEmptyString(key string) (string, error) {
+	str, ok := o.fields[key].(string)
+	if !ok || str == "" {
+		return "", o.invalid(key, "non-empty string")
+	}
+	return str, nil
+}
+
+// number parses number for which valid returns true, expected describes such numbers
+func (o jsonObject) number(key string, expected string, valid func(float64) bool) (float64, error) {
+	number, ok := o.fields[key].(float64)
+	if !ok || !valid(number) {
+		return 0, o.invalid(key, expected)
+	}
+	return number, nil
+}
+
+// integer parses integer which is at least min (0 or 1)
+func (o jsonObject) integer(key string, min int) (int, error) {
+	expected := "positive integer"
+	if min == 0 {
+		expected = "non-negative integer"
+	}
+	number, err := o.number(key, expected, func(number float64) bool {
+		return number >= float64(min) && number == float64(int(number))
+	})
+	return int(number), err
+}
+
+// seconds parses positive number of seconds
+func (o jsonObject) seconds(key string) (time.Duration, error) {
+	seconds, err := o.number(key, "positive number of seconds", func(number float64) bool {
+		return number > 0
+	})
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+func (o jsonObject) array(key string) ([]interface{}, error) {
+	values, ok := o.fields[key].([]interface{})
+	if !ok {
+		return nil, o.invalid(key, "array")
+	}
+	return values, nil
+}
+
+// statusCodes parses array of http status codes, valid tells which codes are allowed
+func (o jsonObject) statusCodes(key string, valid func(int) bool) ([]int, error) {
+	values, err := o.array(key)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]int, 0, len(values))
+	for _, value := range values {
+		code, ok := value.(float64)
+		if !ok || code < 100 || code > 599 || code != float64(int(code)) || !valid(int(code)) {
+			return nil, fmt.Errorf("invalid status code %v in %s", value, o.describe(key))
+		}
+		codes = append(codes, int(code))
+	}
+	return codes, nil
+}
+
+// oneOf parses string which is one of allowed values
+func (o jsonObject) oneOf(key string, allowed ...string) (string, error) {
+	str, _ := o.fields[key].(string)
+	for _, value := range allowed {
+		if str == value {
+			return str, nil
+		}
+	}
+	return "", o.invalid(key, "one of "+strings.Join(allowed, ", "))
+}
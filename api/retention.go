@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Limits of history stored for each url - the oldest responses are evicted when any limit is exceeded.
+// Zero value of each field means that there is no such limit.
+type RetentionPolicy struct {
+	MaxEntries int
+	MaxAge     time.Duration
+	MaxBytes   int
+}
+
+func (r *RetentionPolicy) UnmarshalJSON(j []byte) error {
+	return unmarshalObject(j, r.fromJsonValue)
+}
+
+func (r *RetentionPolicy) fromJsonValue(value interface{}) error {
+	o, err := parseObject("retention", value)
+	if err != nil {
+		return err
+	}
+	for key := range o.fields {
+		switch key {
+		case "max_entries":
+			r.MaxEntries, err = o.integer(key, 0)
+		case "max_age":
+			var seconds float64
+			seconds, err = o.number(key, "non-negative number of seconds", func(number float64) bool {
+				return number >= 0
+			})
+			r.MaxAge = time.Duration(seconds * float64(time.Second))
+		case "max_bytes":
+			r.MaxBytes, err = o.integer(key, 0)
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r RetentionPolicy) MarshalJSON() ([]byte, error) {
+	base := struct {
+		MaxEntries int     `json:"max_entries,omitempty"`
+		MaxAge     float64 `json:"max_age,omitempty"`
+		MaxBytes   int     `json:"max_bytes,omitempty"`
+	}{
+		MaxEntries: r.MaxEntries,
+		MaxAge:     r.MaxAge.Seconds(),
+		MaxBytes:   r.MaxBytes,
+	}
+	return json.Marshal(base)
+}
+
+// Merge returns policy with limits from other overriding limits set in r
+func (r RetentionPolicy) Merge(other *RetentionPolicy) RetentionPolicy {
+	if other == nil {
+		return r
+	}
+	if other.MaxEntries != 0 {
+		r.MaxEntries = other.MaxEntries
+	}
+	if other.MaxAge != 0 {
+		r.MaxAge = other.MaxAge
+	}
+	if other.MaxBytes != 0 {
+		r.MaxBytes = other.MaxBytes
+	}
+	return r
+}
+
+func (r RetentionPolicy) IsUnlimited() bool {
+	return r == RetentionPolicy{}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Retry of failed requests with exponential backoff - n-th retry is made BaseDelay * 2^(n-1) (but at most MaxDelay)
+// after the previous attempt. Only the last attempt is recorded in history.
+type RetryPolicy struct {
+	MaxAttempts int // including the first request
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration // zero means no limit
+	StatusCodes []int         // http status codes which are retried, DefaultRetryStatusCodes if nil
+	Errors      []FetchError  // categories of errors (other than FetchErrorStatus) which are retried, DefaultRetryErrors if nil
+}
+
+var (
+	DefaultRetryStatusCodes = []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	DefaultRetryErrors = []FetchError{FetchErrorTimeout, FetchErrorConnect, FetchErrorBodyRead}
+)
+
+func (r *RetryPolicy) UnmarshalJSON(j []byte) error {
+	return unmarshalObject(j, r.fromJsonValue)
+}
+
+func (r *RetryPolicy) fromJsonValue(value interface{}) error {
+	o, err := parseObject("retry", value)
+	if err != nil {
+		return err
+	}
+	if err := o.require("max_attempts", "base_delay"); err != nil {
+		return err
+	}
+	for key := range o.fields {
+		switch key {
+		case "max_attempts":
+			r.MaxAttempts, err = o.integer(key, 1)
+		case "base_delay":
+			r.BaseDelay, err = o.seconds(key)
+		case "max_delay":
+			r.MaxDelay, err = o.seconds(key)
+		case "status_codes":
+			r.StatusCodes, err = o.statusCodes(key, func(code int) bool {
+				return code < 200 || code > 299 // successful responses are never retried
+			})
+		case "errors":
+			r.Errors, err = parseRetriedErrors(o, key)
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.MaxDelay != 0 && r.MaxDelay < r.BaseDelay {
+		return fmt.Errorf("retry max_delay %s is shorter than base_delay %s", r.MaxDelay, r.BaseDelay)
+	}
+	return nil
+}
+
+func parseRetriedErrors(o jsonObject, key string) ([]FetchError, error) {
+	values, err := o.array(key)
+	if err != nil {
+		return nil, err
+	}
+	fetchErrors := make([]FetchError, 0, len(values))
+	for _, value := range values {
+		fetchError, err := parseRetriedError(value)
+		if err != nil {
+			return nil, err
+		}
+		fetchErrors = append(fetchErrors, fetchError)
+	}
+	return fetchErrors, nil
+}
+
+func parseRetriedError(value interface{}) (FetchError, error) {
+	str, _ := value.(string)
+	if FetchError(str) == FetchErrorStatus {
+		return "", fmt.Errorf("retried http statuses must be given as status_codes")
+	}
+	for _, fetchError := range fetchErrors {
+		if FetchError(str) == fetchError {
+			return fetchError, nil
+		}
+	}
+	return "", fmt.Errorf("invalid retried error %v", value)
+}
+
+func (r RetryPolicy) MarshalJSON() ([]byte, error) {
+	base := struct {
+		MaxAttempts int           `json:"max_attempts"`
+		BaseDelay   float64       `json:"base_delay"`
+		MaxDelay    float64       `json:"max_delay,omitempty"`
+		StatusCodes *[]int        `json:"status_codes,omitempty"` // empty list (nothing is retried) differs from default
+		Errors      *[]FetchError `json:"errors,omitempty"`
+	}{
+		MaxAttempts: r.MaxAttempts,
+		BaseDelay:   r.BaseDelay.Seconds(),
+		MaxDelay:    r.MaxDelay.Seconds(),
+	}
+	if r.StatusCodes != nil {
+		base.StatusCodes = &r.StatusCodes
+	}
+	if r.Errors != nil {
+		base.Errors = &r.Errors
+	}
+	return json.Marshal(base)
+}
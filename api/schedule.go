@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"fetcher/cron"
+)
+
+// Cron or one-shot schedule of fetches - exactly one of Cron and At is set
+type Schedule struct {
+	Cron     string    // expression in format described in package cron
+	TimeZone string    // IANA name of time zone in which Cron is evaluated, UTC if empty
+	At       time.Time // time of the only fetch, it is not made if server is not running at that time
+}
+
+func (s *Schedule) UnmarshalJSON(j []byte) error {
+	return unmarshalObject(j, s.fromJsonValue)
+}
+
+func (s *Schedule) fromJsonValue(value interface{}) error {
+	o, err := parseObject("schedule", value)
+	if err != nil {
+		return err
+	}
+	for key := range o.fields {
+		switch key {
+		case "cron":
+			s.Cron, err = o.nonEmptyString(key)
+		case "timezone":
+			s.TimeZone, err = o.nonEmptyString(key)
+		case "at":
+			var unixTime float64
+			unixTime, err = o.number(key, "unix time", func(number float64) bool {
+				return number == float64(int64(number))
+			})
+			s.At = time.Unix(int64(unixTime), 0)
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return s.Validate()
+}
+
+// Validate checks that exactly one kind of schedule is set and that cron expression and time zone are valid
+func (s *Schedule) Validate() error {
+	if (s.Cron == "") == s.At.IsZero() {
+		return fmt.Errorf("expected exactly one of schedule keys cron, at")
+	}
+	if s.Cron == "" {
+		if s.TimeZone != "" {
+			return fmt.Errorf("schedule key timezone can be used only with cron")
+		}
+		return nil
+	}
+	if _, err := cron.Parse(s.Cron); err != nil {
+		return err
+	}
+	_, err := s.Location()
+	return err
+}
+
+// Location returns time zone in which Cron is evaluated
+func (s *Schedule) Location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %s: %s", s.TimeZone, err)
+	}
+	return location, nil
+}
+
+func (s Schedule) MarshalJSON() ([]byte, error) {
+	base := struct {
+		Cron     string `json:"cron,omitempty"`
+		TimeZone string `json:"timezone,omitempty"`
+		At       *int64 `json:"at,omitempty"`
+	}{
+		Cron:     s.Cron,
+		TimeZone: s.TimeZone,
+	}
+	if !s.At.IsZero() {
+		at := s.At.Unix()
+		base.At = &at
+	}
+	return json.Marshal(base)
+}
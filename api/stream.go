@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Comment sent when stream is idle, so that proxies do not close connection
+const streamKeepAliveInterval = 15 * time.Second
+
+// handleStream sends responses of url (or of all urls, if there is no id in path) as Server-Sent Events.
+// Header Last-Event-ID resumes stream after given event.
+func (a *api) handleStream(writer http.ResponseWriter, request *http.Request) {
+	var query StreamQuery
+	if chi.URLParam(request, "id") != "" {
+		id, err := getIdFromRequest(request)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		query.UrlId = &id
+	}
+	if value := request.Header.Get("Last-Event-ID"); value != "" {
+		lastEventId, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("invalid Last-Event-ID - expected id of event, got %s", value), http.StatusBadRequest)
+			return
+		}
+		query.LastEventId = &lastEventId
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	subscription, err := a.backend.Subscribe(query)
+	if err != nil {
+		writeErrorInHttpResponse(writer, err)
+		return
+	}
+	defer subscription.Cancel()
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no") // disables buffering in nginx
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+			if err := writeStreamEvent(writer, event, query.UrlId == nil); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-request.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeStreamEvent writes event in SSE format. Data of event is history entry, wrapped with id of url in stream of all urls.
+func writeStreamEvent(writer http.ResponseWriter, event StreamEvent, withUrlId bool) error {
+	eventType, data := "response", []byte("{}")
+	var err error
+	if event.Reset {
+		eventType = "reset"
+	} else if withUrlId {
+		data, err = json.Marshal(struct {
+			UrlId uint64       `json:"url_id"`
+			Entry *UrlResponse `json:"entry"`
+		}{UrlId: event.UrlId, Entry: &event.Response})
+	} else {
+		data, err = json.Marshal(&event.Response)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, eventType, data)
+	return err
+}
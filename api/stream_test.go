@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+)
+
+func TestStream(t *testing.T) {
+	backend := &fakeBackend{}
+	r := chi.NewRouter()
+	api.Create(r, backend)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	get := func(path string, lastEventId string) *http.Response {
+		request, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		if lastEventId != "" {
+			request.Header.Set("Last-Event-ID", lastEventId)
+		}
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		return response
+	}
+
+	t.Run("GET /api/fetcher/{id}/stream sends responses of url as events", func(t *testing.T) {
+		response := get("/api/fetcher/11/stream", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(response.Body) // fake subscription is closed after its events
+		require.NoError(t, err)
+		assert.Equal(t, "id: 3\nevent: response\ndata: {\"seq\":3,\"response\":\"abc\",\"encoding\":\"utf-8\",\"duration\":0.5,\"created_at\":1559034638}\n\n"+
+			"id: 4\nevent: reset\ndata: {}\n\n", string(body))
+		require.NotNil(t, backend.lastStreamQuery.UrlId)
+		assert.Equal(t, uint64(11), *backend.lastStreamQuery.UrlId)
+		assert.Nil(t, backend.lastStreamQuery.LastEventId)
+		assert.True(t, backend.streamCancelled)
+	})
+	t.Run("GET /api/fetcher/stream sends responses of all urls with their ids", func(t *testing.T) {
+		response := get("/api/fetcher/stream", "2")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "id: 3\nevent: response\ndata: {\"url_id\":11,\"entry\":{\"seq\":3,\"response\":\"abc\",\"encoding\":\"utf-8\",\"duration\":0.5,\"created_at\":1559034638}}\n\n"+
+			"id: 4\nevent: reset\ndata: {}\n\n", string(body))
+		assert.Nil(t, backend.lastStreamQuery.UrlId)
+		require.NotNil(t, backend.lastStreamQuery.LastEventId)
+		assert.Equal(t, uint64(2), *backend.lastStreamQuery.LastEventId)
+	})
+	t.Run("GET stream of non-existing url returns 404", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/api/fetcher/12/stream", "").StatusCode)
+		assert.Equal(t, http.StatusNotFound, get("/api/fetcher/x/stream", "").StatusCode)
+	})
+	t.Run("GET stream with invalid Last-Event-ID returns 400", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("/api/fetcher/11/stream", "x").StatusCode)
+	})
+}
+
+func (f *fakeBackend) Subscribe(query api.StreamQuery) (api.Subscription, error) {
+	f.lastStreamQuery = query
+	f.streamCancelled = false
+	if query.UrlId != nil && *query.UrlId != 11 {
+		return api.Subscription{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	events := make(chan api.StreamEvent, 2)
+	response := api.UrlResponse{Response: []byte("abc"), Seq: 3, Duration: 500 * time.Millisecond, CreatedAt: time.Unix(1559034638, 0)}
+	events <- api.StreamEvent{Id: 3, UrlId: 11, Response: response}
+	events <- api.StreamEvent{Id: 4, Reset: true}
+	close(events)
+	return api.Subscription{Events: events, Cancel: func() { f.streamCancelled = true }}, nil
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Target of notifications (see Notification). If Secret is set, each notification is signed with it.
+type Webhook struct {
+	Url    *url.URL
+	Secret string
+}
+
+// Notification sent to webhooks (as json in body of POST request) when state of url changes
+type Notification struct {
+	Event        string     // one of Event* constants
+	UrlId        uint64     //
+	Url          string     // with password redacted
+	Seq          uint64     // of response which changed state
+	CreatedAt    time.Time  // of response which changed state
+	StatusCode   int        // 0 if no http response was received
+	Error        FetchError // empty if response was fetched successfully
+	Hash         string     // hash of body (see UrlResponse.Hash), empty if response has no body
+	PreviousHash string     // hash of the previous body, only with EventChanged
+}
+
+// Events which trigger notifications
+const (
+	EventDown    = "down"         // health of url became HealthDown (also in the first fetch)
+	EventUp      = "up"           // health of url is not HealthDown anymore
+	EventChanged = "body_changed" // body differs from body of the previous successful response
+)
+
+// Delivery of notification to webhook, returned by DeliveryLogSource
+type Delivery struct {
+	Id          uint64
+	UrlId       uint64
+	Event       string    // one of Event* constants
+	Webhook     string    // url of webhook without credentials
+	Status      string    // one of Delivery* constants
+	Attempts    int       // number of requests made so far
+	StatusCode  int       // http status of the last attempt, 0 if no response was received
+	Error       string    // why the last attempt failed
+	CreatedAt   time.Time // time of notification
+	LastAttempt time.Time // zero if no attempt was made yet
+}
+
+const (
+	DeliveryPending   = "pending"   // being delivered (possibly waiting for retry)
+	DeliveryDelivered = "delivered" // webhook responded with http status 2xx
+	DeliveryFailed    = "failed"    // all attempts failed
+)
+
+func (w *Webhook) UnmarshalJSON(j []byte) error {
+	return unmarshalObject(j, w.fromJsonValue)
+}
+
+func (w *Webhook) fromJsonValue(value interface{}) error {
+	o, err := parseObject("webhook", value)
+	if err != nil {
+		return err
+	}
+	if err := o.require("url"); err != nil {
+		return err
+	}
+	for key := range o.fields {
+		switch key {
+		case "url":
+			var rawUrl string
+			if rawUrl, err = o.nonEmptyString(key); err == nil {
+				w.Url, err = ParseWebhookUrl(rawUrl)
+			}
+		case "secret":
+			w.Secret, err = o.nonEmptyString(key)
+		default:
+			err = o.unexpectedKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseWebhookUrl parses url of webhook, which must be absolute http or https url
+func ParseWebhookUrl(rawUrl string) (*url.URL, error) {
+	u, err := url.ParseRequestURI(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook url: %s", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %s - expected http or https url", rawUrl)
+	}
+	return u, nil
+}
+
+func (w Webhook) MarshalJSON() ([]byte, error) {
+	base := struct {
+		Url    string `json:"url"`
+		Secret string `json:"secret,omitempty"`
+	}{
+		Url:    w.Url.String(),
+		Secret: w.Secret,
+	}
+	return json.Marshal(base)
+}
+
+func (n Notification) MarshalJSON() ([]byte, error) {
+	base := struct {
+		Event        string     `json:"event"`
+		UrlId        uint64     `json:"url_id"`
+		Url          string     `json:"url"`
+		Seq          uint64     `json:"seq"`
+		CreatedAt    int64      `json:"created_at"`
+		StatusCode   int        `json:"status_code,omitempty"`
+		Error        FetchError `json:"error,omitempty"`
+		Hash         string     `json:"hash,omitempty"`
+		PreviousHash string     `json:"previous_hash,omitempty"`
+	}{
+		Event:        n.Event,
+		UrlId:        n.UrlId,
+		Url:          n.Url,
+		Seq:          n.Seq,
+		CreatedAt:    n.CreatedAt.Unix(),
+		StatusCode:   n.StatusCode,
+		Error:        n.Error,
+		Hash:         n.Hash,
+		PreviousHash: n.PreviousHash,
+	}
+	return json.Marshal(base)
+}
+
+func (d Delivery) MarshalJSON() ([]byte, error) {
+	base := struct {
+		Id          uint64 `json:"id"`
+		UrlId       uint64 `json:"url_id"`
+		Event       string `json:"event"`
+		Webhook     string `json:"webhook"`
+		Status      string `json:"status"`
+		Attempts    int    `json:"attempts"`
+		StatusCode  int    `json:"status_code,omitempty"`
+		Error       string `json:"error,omitempty"`
+		CreatedAt   int64  `json:"created_at"`
+		LastAttempt *int64 `json:"last_attempt"`
+	}{
+		Id:         d.Id,
+		UrlId:      d.UrlId,
+		Event:      d.Event,
+		Webhook:    d.Webhook,
+		Status:     d.Status,
+		Attempts:   d.Attempts,
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+		CreatedAt:  d.CreatedAt.Unix(),
+	}
+	if !d.LastAttempt.IsZero() {
+		lastAttempt := d.LastAttempt.Unix()
+		base.LastAttempt = &lastAttempt
+	}
+	return json.Marshal(base)
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"fetcher/websocket"
+)
+
+// Types of messages sent by client on WebSocket connection
+const (
+	wsSubscribe   = "subscribe"   // receive responses of urls given by url_ids
+	wsUnsubscribe = "unsubscribe" // stop receiving responses of urls given by url_ids
+	wsCreate      = "create"      // create url given by url (the same json as in POST /api/fetcher)
+	wsDelete      = "delete"      // delete url given by url_id
+	wsPause       = "pause"       // pause fetching of url given by url_id
+	wsResume      = "resume"      // resume fetching of url given by url_id
+)
+
+// Types of messages sent by server
+const (
+	wsOk           = "ok"           // request with given id succeeded, result (if any) is in result
+	wsError        = "error"        // request with given id (null if it could not be read) failed
+	wsResponse     = "response"     // response of subscribed url
+	wsUnsubscribed = "unsubscribed" // url was deleted or connection did not keep up with its responses
+)
+
+// wsRequest is message sent by client. Id is any json value chosen by client - it is returned in reply.
+type wsRequest struct {
+	Id     json.RawMessage `json:"id"`
+	Type   string          `json:"type"`
+	UrlIds []uint64        `json:"url_ids"`
+	UrlId  *uint64         `json:"url_id"`
+	Url    json.RawMessage `json:"url"` // decoded separately, so that id of request is known if url is invalid
+}
+
+// wsMessage is message sent by server
+type wsMessage struct {
+	Id     json.RawMessage `json:"id,omitempty"`
+	Type   string          `json:"type"`
+	Result interface{}     `json:"result,omitempty"`
+	Code   int             `json:"code,omitempty"` // http status corresponding to error
+	Error  string          `json:"error,omitempty"`
+	UrlId  *uint64         `json:"url_id,omitempty"`
+	Entry  *UrlResponse    `json:"entry,omitempty"`
+}
+
+// wsSession serves single WebSocket connection
+type wsSession struct {
+	backend       Backend
+	conn          *websocket.Conn
+	mutex         sync.Mutex
+	subscriptions map[uint64]Subscription
+	forwarders    sync.WaitGroup
+	replied       chan struct{} // closed when reply to the current request is sent
+}
+
+// handleWebSocket serves WebSocket API - client sends requests and receives replies and responses of subscribed urls
+func (a *api) handleWebSocket(writer http.ResponseWriter, request *http.Request) {
+	conn, err := websocket.Upgrade(writer, request)
+	if err != nil {
+		return
+	}
+	conn.MaxMessageSize = MaxPostBodySize
+	s := &wsSession{backend: a.backend, conn: conn, subscriptions: make(map[uint64]Subscription)}
+	defer s.close()
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.TextMessage {
+			s.sendError(nil, http.StatusBadRequest, "expected text message")
+			continue
+		}
+		s.handle(data)
+	}
+}
+
+func (s *wsSession) handle(data []byte) {
+	s.replied = make(chan struct{})
+	defer close(s.replied)
+	var request wsRequest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		s.sendError(nil, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+		return
+	}
+	result, err := s.execute(request)
+	if requestError, ok := err.(wsRequestError); ok {
+		s.sendError(request.Id, requestError.status, requestError.message)
+		return
+	}
+	if err != nil {
+		status, message := errorStatus(err)
+		s.sendError(request.Id, status, message)
+		return
+	}
+	s.send(wsMessage{Id: request.Id, Type: wsOk, Result: result})
+}
+
+// wsRequestError is returned by execute for invalid requests
+type wsRequestError struct {
+	status  int
+	message string
+}
+
+func (e wsRequestError) Error() string {
+	return e.message
+}
+
+func (s *wsSession) execute(request wsRequest) (interface{}, error) {
+	switch request.Type {
+	case wsSubscribe, wsUnsubscribe:
+		if len(request.UrlIds) == 0 {
+			return nil, wsRequestError{http.StatusBadRequest, "missing url_ids"}
+		}
+		if request.Type == wsUnsubscribe {
+			s.unsubscribe(request.UrlIds)
+			return nil, nil
+		}
+		return nil, s.subscribe(request.UrlIds)
+	case wsCreate:
+		if request.Url == nil {
+			return nil, wsRequestError{http.StatusBadRequest, "missing url"}
+		}
+		var newUrl NewUrl
+		if err := json.Unmarshal(request.Url, &newUrl); err != nil {
+			return nil, wsRequestError{http.StatusBadRequest, fmt.Sprintf("invalid url: %s", err)}
+		}
+		return s.backend.PostNewUrl(newUrl)
+	case wsDelete, wsPause, wsResume:
+		if request.UrlId == nil {
+			return nil, wsRequestError{http.StatusBadRequest, "missing url_id"}
+		}
+		switch request.Type {
+		case wsPause:
+			return nil, s.backend.PauseUrl(*request.UrlId)
+		case wsResume:
+			return nil, s.backend.ResumeUrl(*request.UrlId)
+		}
+		return nil, s.backend.DeleteUrl(*request.UrlId)
+	default:
+		return nil, wsRequestError{http.StatusBadRequest, fmt.Sprintf("unknown type %q", request.Type)}
+	}
+}
+
+// subscribe subscribes to all given urls or to none of them, if any does not exist
+func (s *wsSession) subscribe(urlIds []uint64) error {
+	added := make(map[uint64]Subscription)
+	for _, urlId := range urlIds {
+		s.mutex.Lock()
+		_, subscribed := s.subscriptions[urlId]
+		s.mutex.Unlock()
+		if _, ok := added[urlId]; ok || subscribed {
+			continue
+		}
+		id := urlId
+		subscription, err := s.backend.Subscribe(StreamQuery{UrlId: &id})
+		if err != nil {
+			for _, subscription := range added {
+				subscription.Cancel()
+			}
+			return err
+		}
+		added[urlId] = subscription
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for urlId, subscription := range added {
+		s.subscriptions[urlId] = subscription
+		s.forwarders.Add(1)
+		go s.forward(urlId, subscription, s.replied)
+	}
+	return nil
+}
+
+func (s *wsSession) unsubscribe(urlIds []uint64) {
+	for _, urlId := range urlIds {
+		s.mutex.Lock()
+		subscription, ok := s.subscriptions[urlId]
+		delete(s.subscriptions, urlId)
+		s.mutex.Unlock()
+		if ok {
+			subscription.Cancel()
+		}
+	}
+}
+
+// forward sends responses of url to client (after reply to subscribe request) until subscription is closed
+func (s *wsSession) forward(urlId uint64, subscription Subscription, replied chan struct{}) {
+	defer s.forwarders.Done()
+	<-replied
+	for event := range subscription.Events {
+		if !event.Reset {
+			s.send(wsMessage{Type: wsResponse, UrlId: &urlId, Entry: &event.Response})
+		}
+	}
+	s.mutex.Lock()
+	current, ok := s.subscriptions[urlId]
+	closedByBackend := ok && current.Events == subscription.Events // otherwise client unsubscribed
+	if closedByBackend {
+		delete(s.subscriptions, urlId)
+	}
+	s.mutex.Unlock()
+	if closedByBackend {
+		subscription.Cancel()
+		s.send(wsMessage{Type: wsUnsubscribed, UrlId: &urlId})
+	}
+}
+
+func (s *wsSession) sendError(id json.RawMessage, status int, message string) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	s.send(wsMessage{Id: id, Type: wsError, Code: status, Error: message})
+}
+
+// send writes message to client, errors are ignored - reading fails as well when connection is broken
+func (s *wsSession) send(message wsMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		data, _ = json.Marshal(wsMessage{Id: message.Id, Type: wsError, Code: http.StatusInternalServerError, Error: err.Error()})
+	}
+	_ = s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// close cancels all subscriptions and closes connection
+func (s *wsSession) close() {
+	s.mutex.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = make(map[uint64]Subscription)
+	s.mutex.Unlock()
+	for _, subscription := range subscriptions {
+		subscription.Cancel()
+	}
+	s.conn.Close() // fails writes of forwarders which still send buffered responses
+	s.forwarders.Wait()
+}
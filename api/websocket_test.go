@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	backend := &fakeBackend{}
+	r := chi.NewRouter()
+	api.Create(r, backend)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	conn, err := websocket.Dial("ws" + strings.TrimPrefix(server.URL, "http") + "/api/fetcher/ws")
+	require.NoError(t, err)
+	defer conn.Close()
+	request := func(message string) {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+	}
+	receive := func() string {
+		messageType, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.TextMessage, messageType)
+		return string(data)
+	}
+
+	t.Run("subscribe sends responses of urls", func(t *testing.T) {
+		request(`{"id":1,"type":"subscribe","url_ids":[11]}`)
+		assert.Equal(t, `{"id":1,"type":"ok"}`, receive())
+		assert.Equal(t, `{"type":"response","url_id":11,"entry":{"seq":3,"response":"abc","encoding":"utf-8","duration":0.5,"created_at":1559034638}}`, receive())
+		// fake subscription is closed after its events
+		assert.Equal(t, `{"type":"unsubscribed","url_id":11}`, receive())
+	})
+	t.Run("subscribe returns error if any url does not exist", func(t *testing.T) {
+		request(`{"id":"a","type":"subscribe","url_ids":[11,12]}`)
+		assert.Equal(t, `{"id":"a","type":"error","code":404,"error":"Not Found"}`, receive())
+	})
+	t.Run("unsubscribe returns ok", func(t *testing.T) {
+		request(`{"id":2,"type":"unsubscribe","url_ids":[11]}`)
+		assert.Equal(t, `{"id":2,"type":"ok"}`, receive())
+	})
+	t.Run("create posts new url and returns its id", func(t *testing.T) {
+		request(`{"id":3,"type":"create","url":{"url":"https://httpbin.org/range/15","interval":60}}`)
+		assert.Equal(t, `{"id":3,"type":"ok","result":{"id":11}}`, receive())
+	})
+	t.Run("create with invalid url returns error", func(t *testing.T) {
+		request(`{"id":4,"type":"create","url":{"url":"https://httpbin.org/range/15"}}`)
+		assert.Equal(t, `{"id":4,"type":"error","code":400,"error":"invalid url: expected exactly one of keys interval, schedule in json {\"url\":\"https://httpbin.org/range/15\"}"}`, receive())
+		request(`{"id":4,"type":"create"}`)
+		assert.Equal(t, `{"id":4,"type":"error","code":400,"error":"missing url"}`, receive())
+	})
+	t.Run("delete deletes url", func(t *testing.T) {
+		request(`{"id":5,"type":"delete","url_id":11}`)
+		assert.Equal(t, `{"id":5,"type":"ok"}`, receive())
+		request(`{"id":6,"type":"delete","url_id":12}`)
+		assert.Equal(t, `{"id":6,"type":"error","code":404,"error":"Not Found"}`, receive())
+	})
+	t.Run("pause and resume change state of url", func(t *testing.T) {
+		request(`{"id":7,"type":"pause","url_id":11}`)
+		assert.Equal(t, `{"id":7,"type":"ok"}`, receive())
+		request(`{"id":7,"type":"resume","url_id":11}`)
+		assert.Equal(t, `{"id":7,"type":"ok"}`, receive())
+		request(`{"id":7,"type":"resume","url_id":12}`)
+		assert.Equal(t, `{"id":7,"type":"error","code":404,"error":"Not Found"}`, receive())
+		request(`{"id":7,"type":"pause"}`)
+		assert.Equal(t, `{"id":7,"type":"error","code":400,"error":"missing url_id"}`, receive())
+	})
+	t.Run("invalid requests return errors", func(t *testing.T) {
+		for message, expected := range map[string]string{
+			`{"id":8,"type":"restart"}`:           `{"id":8,"type":"error","code":400,"error":"unknown type \"restart\""}`,
+			`{"id":9,"type":"subscribe"}`:         `{"id":9,"type":"error","code":400,"error":"missing url_ids"}`,
+			`{"id":10,"type":"delete"}`:           `{"id":10,"type":"error","code":400,"error":"missing url_id"}`,
+			`{"id":11,"type":"delete","extra":1}`: `{"id":null,"type":"error","code":400,"error":"invalid request: json: unknown field \"extra\""}`,
+			`not json`:                            `{"id":null,"type":"error","code":400,"error":"invalid request: invalid character 'o' in literal null (expecting 'u')"}`,
+		} {
+			request(message)
+			assert.Equal(t, expected, receive(), message)
+		}
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("{}")))
+		assert.Equal(t, `{"id":null,"type":"error","code":400,"error":"expected text message"}`, receive())
+	})
+}
@@ -0,0 +1,23 @@
+// Package clock provides source of time which tests can replace with virtual time.
+package clock
+
+import "time"
+
+// Clock is source of time for scheduling, timeouts and delays
+type Clock interface {
+	Now() time.Time
+	// Timer returns channel which receives current time when deadline is reached, and function which releases timer
+	Timer(deadline time.Time) (<-chan time.Time, func())
+}
+
+// Real is Clock which uses real time
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) Timer(deadline time.Time) (<-chan time.Time, func()) {
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, func() { timer.Stop() }
+}
@@ -0,0 +1,68 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is Clock for tests, which moves only when Advance is called
+type Fake struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, timers: make(map[*fakeTimer]struct{})}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *Fake) Timer(deadline time.Time) (<-chan time.Time, func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := &fakeTimer{deadline: deadline, c: make(chan time.Time, 1)}
+	if deadline.After(c.now) {
+		c.timers[t] = struct{}{}
+	} else {
+		t.c <- c.now
+	}
+	return t.c, func() {
+		c.mutex.Lock()
+		delete(c.timers, t)
+		c.mutex.Unlock()
+	}
+}
+
+func (c *Fake) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	for t := range c.timers {
+		if !t.deadline.After(c.now) {
+			t.c <- c.now
+			delete(c.timers, t)
+		}
+	}
+}
+
+// HasTimer reports whether timer with given deadline is waiting
+func (c *Fake) HasTimer(deadline time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for t := range c.timers {
+		if t.deadline.Equal(deadline) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
 
@@ -8,14 +9,81 @@ import (
 	"github.com/go-chi/chi/middleware"
 
 	"fetcher/api"
+	"fetcher/notify"
+	"fetcher/storage"
 	"fetcher/urls"
 	"fetcher/worker"
 )
 
 func main() {
+	storagePath := flag.String("storage", "", "path to file in which urls and their history are stored (if empty, everything is kept only in memory)")
+	var retention api.RetentionPolicy
+	flag.IntVar(&retention.MaxEntries, "max-history-entries", 0, "default maximum number of responses stored for each url (0 means no limit)")
+	flag.DurationVar(&retention.MaxAge, "max-history-age", 0, "default maximum age of responses stored for each url (0 means no limit)")
+	flag.IntVar(&retention.MaxBytes, "max-history-bytes", 0, "default maximum total size of responses stored for each url (0 means no limit)")
+	timeout := flag.Duration("timeout", worker.DefaultTimeout, "default timeout of requests for urls which do not have their own timeout")
+	executors := flag.Int("executors", worker.DefaultExecutors, "maximum number of concurrent requests")
+	maxPerHost := flag.Int("max-per-host", 0, "maximum number of concurrent requests to the same host (0 means no limit)")
+	maxBodySize := flag.Int64("max-body-size", worker.DefaultMaxBodySize, "default maximum size of response body in bytes (longer bodies are truncated)")
+	spread := flag.Bool("spread", false, "distribute fetches of urls with the same interval evenly across the interval")
+	webhookUrl := flag.String("webhook", "", "url to which notifications about state changes of all urls are sent (besides webhooks of each url)")
+	webhookSecret := flag.String("webhook-secret", "", "secret used to sign notifications sent to url given by -webhook")
+	flag.Parse()
+	if *timeout <= 0 {
+		fmt.Println("Timeout must be positive")
+		return
+	}
+	if *executors < 1 {
+		fmt.Println("Number of executors must be positive")
+		return
+	}
+	if *maxBodySize < 1 {
+		fmt.Println("Maximum body size must be positive")
+		return
+	}
+
+	var notifyOptions []notify.Option
+	if *webhookUrl != "" {
+		u, err := api.ParseWebhookUrl(*webhookUrl)
+		if err != nil {
+			fmt.Println("Invalid webhook:", err)
+			return
+		}
+		notifyOptions = append(notifyOptions, notify.WithGlobalWebhooks(api.Webhook{Url: u, Secret: *webhookSecret}))
+	}
+	notifier := notify.New(notifyOptions...)
+
+	options := []urls.Option{urls.WithRetention(retention), urls.WithNotifier(notifier)}
+	if *storagePath != "" {
+		fileStorage, err := storage.OpenFile(*storagePath)
+		if err != nil {
+			fmt.Println("Failed to open storage:", err)
+			return
+		}
+		defer fileStorage.Close()
+		options = append(options, urls.WithStorage(fileStorage))
+	}
+	workerOptions := []worker.Option{
+		worker.WithDefaultTimeout(*timeout),
+		worker.WithExecutors(*executors),
+		worker.WithMaxPerHost(*maxPerHost),
+		worker.WithMaxBodySize(*maxBodySize),
+	}
+	if *spread {
+		workerOptions = append(workerOptions, worker.WithSpread())
+	}
+	fetchWorker := worker.New(workerOptions...)
+	urlsBackend := urls.New(fetchWorker, options...)
+	if err := urlsBackend.LoadFromStorage(); err != nil {
+		fmt.Println("Failed to load urls from storage:", err)
+		return
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
-	api.Create(r, urls.New(worker.New()))
+	api.Create(r, urlsBackend)
+	api.CreateWorkerStats(r, fetchWorker)
+	api.CreateNotifications(r, notifier)
 	fmt.Println("Starting server on port 8080 ...")
 	err := http.ListenAndServe(":8080", r)
 	if err != nil {
@@ -0,0 +1,176 @@
+// Package cron parses cron expressions and computes times matching them
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expression is parsed cron expression with 5 fields: minute, hour, day of month, month, day of week.
+// Each field may be *, number, name (JAN-DEC, SUN-SAT), range (a-b), step (*/n, a-b/n) or comma-separated list of them.
+// As in standard cron, when both day of month and day of week are restricted, time matching either of them matches.
+type Expression struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	// true if field is * (or */1) - it matters for day of month and day of week
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string // names of values starting from min
+}
+
+var (
+	minuteField     = field{name: "minute", min: 0, max: 59}
+	hourField       = field{name: "hour", min: 0, max: 23}
+	dayOfMonthField = field{name: "day of month", min: 1, max: 31}
+	monthField      = field{name: "month", min: 1, max: 12,
+		names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}}
+	// 7 is accepted as Sunday (like in most cron implementations) and folded onto 0 after parsing
+	dayOfWeekField = field{name: "day of week", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSearchYears limits Next for expressions which (almost) never match, e.g. 30th of February
+const maxSearchYears = 5
+
+func Parse(expression string) (*Expression, error) {
+	if macro, ok := macros[strings.ToLower(strings.TrimSpace(expression))]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q - expected 5 fields, got %d", expression, len(fields))
+	}
+	var e Expression
+	var err error
+	if e.minute, _, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if e.hour, _, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if e.dayOfMonth, e.anyDayOfMonth, err = dayOfMonthField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if e.month, _, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if e.dayOfWeek, e.anyDayOfWeek, err = dayOfWeekField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if e.dayOfWeek&(1<<7) != 0 {
+		e.dayOfWeek = e.dayOfWeek&^(1<<7) | 1
+	}
+	return &e, nil
+}
+
+// parse returns bit set of values matching field and whether it matches any value
+func (f field) parse(s string) (uint64, bool, error) {
+	var bits uint64
+	anyValue := false
+	for _, part := range strings.Split(s, ",") {
+		rangeAndStep := strings.SplitN(part, "/", 2)
+		start, end := f.min, f.max
+		if rangeAndStep[0] == "*" {
+			anyValue = len(rangeAndStep) == 1 || rangeAndStep[1] == "1"
+		} else {
+			bounds := strings.SplitN(rangeAndStep[0], "-", 2)
+			var err error
+			if start, err = f.parseValue(bounds[0]); err != nil {
+				return 0, false, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = f.parseValue(bounds[1]); err != nil {
+					return 0, false, err
+				}
+			} else if len(rangeAndStep) == 2 {
+				end = f.max // "a/n" means "a-max/n"
+			}
+			if start > end {
+				return 0, false, fmt.Errorf("invalid range %s in %s field", rangeAndStep[0], f.name)
+			}
+		}
+		step := 1
+		if len(rangeAndStep) == 2 {
+			var err error
+			step, err = strconv.Atoi(rangeAndStep[1])
+			if err != nil || step <= 0 {
+				return 0, false, fmt.Errorf("invalid step %s in %s field", rangeAndStep[1], f.name)
+			}
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, anyValue, nil
+}
+
+func (f field) parseValue(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("invalid value %s in %s field - expected number from %d to %d", s, f.name, f.min, f.max)
+	}
+	return value, nil
+}
+
+// Next returns the first time after t (in location of t) matching expression, or zero time if there is no such time
+// in the next few years
+func (e *Expression) Next(t time.Time) time.Time {
+	location := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case e.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+		case !e.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+		case e.hour&(1<<uint(t.Hour())) == 0:
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+			if !next.After(t) {
+				// hour is repeated when clock is turned back
+				next = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			}
+			t = next
+		case e.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (e *Expression) matchesDay(t time.Time) bool {
+	dayOfMonth := e.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := e.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if e.anyDayOfMonth || e.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
@@ -0,0 +1,77 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/cron"
+)
+
+func TestParse(t *testing.T) {
+	for _, valid := range []string{
+		"* * * * *",
+		"*/5 9-17 * * MON-FRI",
+		"0,30 */2 1-15/3 jan-jun sun",
+		"5/15 0 * * 7",
+		"@hourly",
+	} {
+		_, err := cron.Parse(valid)
+		assert.NoError(t, err, valid)
+	}
+	for _, invalid := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * FOO *",
+		"@every 5m",
+	} {
+		_, err := cron.Parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestNext(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	require.NoError(t, err)
+	testCases := []struct {
+		expression string
+		after      time.Time
+		expected   time.Time
+	}{
+		{"* * * * *", time.Date(2020, 8, 24, 10, 0, 30, 0, time.UTC), time.Date(2020, 8, 24, 10, 1, 0, 0, time.UTC)},
+		{"*/5 9-17 * * MON-FRI", time.Date(2020, 8, 24, 10, 3, 0, 0, time.UTC), time.Date(2020, 8, 24, 10, 5, 0, 0, time.UTC)},
+		{"*/5 9-17 * * MON-FRI", time.Date(2020, 8, 24, 17, 55, 0, 0, time.UTC), time.Date(2020, 8, 25, 9, 0, 0, 0, time.UTC)},
+		{"*/5 9-17 * * MON-FRI", time.Date(2020, 8, 28, 18, 0, 0, 0, time.UTC), time.Date(2020, 8, 31, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC), time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 12 30 2 *", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+		// day of month or day of week when both are restricted
+		{"0 0 13 * FRI", time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * FRI", time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC), time.Date(2020, 8, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), time.Date(2020, 8, 30, 0, 0, 0, 0, time.UTC)},
+		// time zones and daylight saving time changes
+		{"0 9 * * *", time.Date(2020, 8, 24, 8, 0, 0, 0, time.UTC), time.Date(2020, 8, 25, 9, 0, 0, 0, warsaw)},
+		{"30 2 * * *", time.Date(2020, 3, 28, 12, 0, 0, 0, warsaw), time.Date(2020, 3, 30, 2, 30, 0, 0, warsaw)},
+		{"0 * * * *", time.Date(2020, 10, 25, 2, 0, 0, 0, warsaw), time.Date(2020, 10, 25, 2, 0, 0, 0, warsaw).Add(time.Hour)},
+	}
+	for _, testCase := range testCases {
+		expression, err := cron.Parse(testCase.expression)
+		require.NoError(t, err)
+		after := testCase.after
+		if testCase.expected.Location() == warsaw {
+			after = after.In(warsaw)
+		}
+		next := expression.Next(after)
+		assert.True(t, testCase.expected.Equal(next), "%s after %s: expected %s, got %s", testCase.expression, after, testCase.expected, next)
+	}
+}
@@ -0,0 +1,136 @@
+package diff_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/diff"
+)
+
+func TestUnified(t *testing.T) {
+	t.Run("equal texts have empty diff", func(t *testing.T) {
+		assert.Equal(t, "", diff.Unified("a", "b", "", ""))
+		assert.Equal(t, "", diff.Unified("a", "b", "x\ny\n", "x\ny\n"))
+	})
+	t.Run("changes are shown with context", func(t *testing.T) {
+		a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+		b := "1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n12\n14\n15\n16\n"
+		expected := "--- seq 1\n+++ seq 2\n" +
+			"@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+four\n 5\n 6\n 7\n" +
+			"@@ -10,6 +10,6 @@\n 10\n 11\n 12\n-13\n 14\n 15\n+16\n"
+		assert.Equal(t, expected, diff.Unified("seq 1", "seq 2", a, b))
+	})
+	t.Run("close changes are in one hunk", func(t *testing.T) {
+		a := "a\nb\nc\nd\ne\nf\ng\nh\n"
+		b := "A\nb\nc\nd\ne\nf\ng\nH\n"
+		expected := "--- a\n+++ b\n@@ -1,8 +1,8 @@\n-a\n+A\n b\n c\n d\n e\n f\n g\n-h\n+H\n"
+		assert.Equal(t, expected, diff.Unified("a", "b", a, b))
+	})
+	t.Run("missing newline at end is marked", func(t *testing.T) {
+		expected := "--- a\n+++ b\n@@ -1 +1 @@\n-abc\n\\ No newline at end of file\n+abc\n"
+		assert.Equal(t, expected, diff.Unified("a", "b", "abc", "abc\n"))
+	})
+	t.Run("empty text", func(t *testing.T) {
+		assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n", diff.Unified("a", "b", "", "x\ny\n"))
+		assert.Equal(t, "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-x\n-y\n", diff.Unified("a", "b", "x\ny\n", ""))
+	})
+	t.Run("diff is minimal", func(t *testing.T) {
+		a := "a\nb\nc\na\nb\nb\na\n"
+		b := "c\nb\na\nb\na\nc\n"
+		unified := diff.Unified("a", "b", a, b)
+		changed := 0
+		for _, line := range strings.Split(unified, "\n")[2:] {
+			if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") {
+				changed++
+			}
+		}
+		assert.Equal(t, 5, changed) // example from Myers' paper
+		assert.Equal(t, b, apply(t, a, unified))
+	})
+	t.Run("texts differing by more than MaxEdits lines", func(t *testing.T) {
+		var a, b strings.Builder
+		for i := 0; i < diff.MaxEdits; i++ {
+			a.WriteString("a\n")
+			b.WriteString("b\n")
+		}
+		unified := diff.Unified("a", "b", a.String(), b.String())
+		assert.Equal(t, b.String(), apply(t, a.String(), unified))
+	})
+	t.Run("memory used by diff of long texts is linear", func(t *testing.T) {
+		var a, b strings.Builder
+		for i := 0; i < 100000; i++ {
+			fmt.Fprintf(&a, "%d\n", i)
+			if i%50 == 0 {
+				fmt.Fprintf(&b, "changed %d\n", i) // 4000 edits, which would need over 100MB with quadratic memory
+			} else {
+				fmt.Fprintf(&b, "%d\n", i)
+			}
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		unified := diff.Unified("a", "b", a.String(), b.String())
+		runtime.ReadMemStats(&after)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(32<<20))
+		assert.Equal(t, 2000, strings.Count(unified, "\n+changed"))
+	})
+}
+
+// apply applies single-hunk unified diff with full context to text a
+func apply(t *testing.T, a, unified string) string {
+	lines := strings.SplitAfter(unified, "\n")
+	require.True(t, strings.HasPrefix(lines[2], "@@"))
+	var result, original strings.Builder
+	for _, line := range lines[3:] {
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case ' ':
+			original.WriteString(line[1:])
+			result.WriteString(line[1:])
+		case '-':
+			original.WriteString(line[1:])
+		case '+':
+			result.WriteString(line[1:])
+		default:
+			require.Fail(t, "unexpected line", line)
+		}
+	}
+	require.Equal(t, a, original.String())
+	return result.String()
+}
+
+func TestJson(t *testing.T) {
+	decode := func(s string) interface{} {
+		var value interface{}
+		require.NoError(t, json.Unmarshal([]byte(s), &value))
+		return value
+	}
+	t.Run("equal values have no changes", func(t *testing.T) {
+		assert.Empty(t, diff.Json(decode(`{"a":[1,{"b":null}]}`), decode(`{"a":[1,{"b":null}]}`)))
+	})
+	t.Run("changes are listed with paths", func(t *testing.T) {
+		a := decode(`{"name":"x","items":[1,2,3],"nested":{"on":true,"content-type":"a"},"old":1}`)
+		b := decode(`{"name":"y","items":[1,5],"nested":{"on":true,"content-type":"b","new":[]},"type":"z"}`)
+		expected := []diff.Change{
+			{Path: "$.items[1]", Op: diff.Changed, From: 2.0, To: 5.0},
+			{Path: "$.items[2]", Op: diff.Removed, From: 3.0},
+			{Path: "$.name", Op: diff.Changed, From: "x", To: "y"},
+			{Path: `$.nested["content-type"]`, Op: diff.Changed, From: "a", To: "b"},
+			{Path: "$.nested.new", Op: diff.Added, To: []interface{}{}},
+			{Path: "$.old", Op: diff.Removed, From: 1.0},
+			{Path: "$.type", Op: diff.Added, To: "z"},
+		}
+		assert.Equal(t, expected, diff.Json(a, b))
+	})
+	t.Run("values of different types are changed", func(t *testing.T) {
+		expected := []diff.Change{{Path: "$", Op: diff.Changed, From: []interface{}{}, To: map[string]interface{}{}}}
+		assert.Equal(t, expected, diff.Json(decode(`[]`), decode(`{}`)))
+	})
+}
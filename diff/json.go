@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Kinds of changes in json diff
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change of value at given path between two json values
+type Change struct {
+	Path string      // JSONPath of value, e.g. $.items[2].name or $["content-type"]
+	Op   string      // one of Added, Removed, Changed
+	From interface{} // nil if value was added
+	To   interface{} // nil if value was removed
+}
+
+// Json returns changes which transform json value a into b (both decoded by encoding/json into interface{}).
+// Objects are compared key by key (keys are sorted) and arrays index by index, values of different types are changed.
+func Json(a, b interface{}) []Change {
+	var changes []Change
+	jsonDiff("$", a, b, &changes)
+	return changes
+}
+
+func jsonDiff(path string, a, b interface{}, changes *[]Change) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a)+len(b))
+			for key := range a {
+				keys = append(keys, key)
+			}
+			for key := range b {
+				if _, ok := a[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				aValue, inA := a[key]
+				bValue, inB := b[key]
+				keyPath := path + pathKey(key)
+				switch {
+				case !inA:
+					*changes = append(*changes, Change{Path: keyPath, Op: Added, To: bValue})
+				case !inB:
+					*changes = append(*changes, Change{Path: keyPath, Op: Removed, From: aValue})
+				default:
+					jsonDiff(keyPath, aValue, bValue, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			for i := 0; i < len(a) || i < len(b); i++ {
+				indexPath := path + "[" + strconv.Itoa(i) + "]"
+				switch {
+				case i >= len(a):
+					*changes = append(*changes, Change{Path: indexPath, Op: Added, To: b[i]})
+				case i >= len(b):
+					*changes = append(*changes, Change{Path: indexPath, Op: Removed, From: a[i]})
+				default:
+					jsonDiff(indexPath, a[i], b[i], changes)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Path: path, Op: Changed, From: a, To: b})
+	}
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// pathKey returns JSONPath selector of object key
+func pathKey(key string) string {
+	if identifier.MatchString(key) {
+		return "." + key
+	}
+	return "[" + strconv.Quote(key) + "]"
+}
@@ -0,0 +1,241 @@
+// Package diff computes differences between texts (in unified format) and between json values
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Number of unchanged lines shown around each change in unified diff
+const ContextLines = 3
+
+// MaxEdits limits work of diff algorithm (its memory is linear in length of texts) - if texts differ by more
+// inserted and deleted lines, diff replaces all lines between common prefix and suffix
+const MaxEdits = 4096
+
+type edit struct {
+	kind byte // ' ' (line is in both texts), '-' (deleted) or '+' (inserted)
+	line string
+}
+
+// Unified returns diff of texts a and b in unified format (with given names of texts in header),
+// empty if texts are equal
+func Unified(fromName, toName, a, b string) string {
+	edits := editScript(Lines(a), Lines(b))
+	// edit is shown if there is a change at most ContextLines edits before or after it
+	shown := make([]bool, len(edits))
+	lastChange := -ContextLines - 1
+	for i, e := range edits {
+		if e.kind != ' ' {
+			lastChange = i
+		}
+		shown[i] = i-lastChange <= ContextLines
+	}
+	lastChange = len(edits) + ContextLines + 1
+	for i := len(edits) - 1; i >= 0; i-- {
+		if edits[i].kind != ' ' {
+			lastChange = i
+		}
+		shown[i] = shown[i] || lastChange-i <= ContextLines
+	}
+	var builder strings.Builder
+	aLine, bLine := 0, 0 // number of lines before current edit
+	for i := 0; i < len(edits); {
+		if !shown[i] {
+			aLine, bLine = advance(edits[i], aLine, bLine)
+			i++
+			continue
+		}
+		end := i
+		for end < len(edits) && shown[end] {
+			end++
+		}
+		if builder.Len() == 0 {
+			fmt.Fprintf(&builder, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		aStart, bStart := aLine, bLine
+		for _, e := range edits[i:end] {
+			aLine, bLine = advance(e, aLine, bLine)
+		}
+		fmt.Fprintf(&builder, "@@ -%s +%s @@\n", hunkRange(aStart, aLine-aStart), hunkRange(bStart, bLine-bStart))
+		for _, e := range edits[i:end] {
+			builder.WriteByte(e.kind)
+			builder.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return builder.String()
+}
+
+func advance(e edit, aLine, bLine int) (int, int) {
+	if e.kind != '+' {
+		aLine++
+	}
+	if e.kind != '-' {
+		bLine++
+	}
+	return aLine, bLine
+}
+
+// hunkRange formats range of lines in hunk header - start is 1-based, but for empty range it is the line before it
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
+
+// Lines splits text into lines, each with its newline character (the last line may not have it)
+func Lines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript returns the shortest (or, with more than MaxEdits changes, not necessarily shortest) edits which
+// transform a into b
+func editScript(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits := make([]edit, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{kind: ' ', line: line})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{kind: ' ', line: line})
+	}
+	return edits
+}
+
+// myers implements "An O(ND) Difference Algorithm and Its Variations" by Eugene W. Myers in its linear space
+// variant - the middle snake of the shortest edit script splits texts in two parts, which are compared recursively
+func myers(a, b []string) []edit {
+	size := 2*(len(a)+len(b)) + 4
+	s := &script{a: a, b: b, forward: make([]int, size), backward: make([]int, size), edits: make([]edit, 0, len(a)+len(b))}
+	if s.compare(0, len(a), 0, len(b), MaxEdits) {
+		return s.edits
+	}
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, edit{kind: '-', line: line})
+	}
+	for _, line := range b {
+		edits = append(edits, edit{kind: '+', line: line})
+	}
+	return edits
+}
+
+type script struct {
+	a, b     []string
+	forward  []int // forward[offset+k] is the furthest x reached from the start on diagonal k (y = x - k)
+	backward []int // backward[offset+k] is the furthest x reached from the end on diagonal k, counted backwards
+	edits    []edit
+}
+
+// compare appends edits transforming a[aStart:aEnd] into b[bStart:bEnd]. It returns false without appending
+// anything if they differ by more than maxEdits inserted and deleted lines.
+func (s *script) compare(aStart, aEnd, bStart, bEnd, maxEdits int) bool {
+	prefix := 0
+	for aStart+prefix < aEnd && bStart+prefix < bEnd && s.a[aStart+prefix] == s.b[bStart+prefix] {
+		prefix++
+	}
+	suffix := 0
+	for aStart+prefix < aEnd-suffix && bStart+prefix < bEnd-suffix && s.a[aEnd-1-suffix] == s.b[bEnd-1-suffix] {
+		suffix++
+	}
+	var x, y, u, v int
+	if aStart+prefix < aEnd-suffix && bStart+prefix < bEnd-suffix {
+		// both parts are not empty, so they differ by at least 2 edits and are split by middle snake to smaller parts
+		var ok bool
+		x, y, u, v, ok = s.middleSnake(aStart+prefix, aEnd-suffix, bStart+prefix, bEnd-suffix, maxEdits)
+		if !ok {
+			return false
+		}
+	}
+	s.appendLines(' ', s.a[aStart:aStart+prefix])
+	aStart, aEnd, bStart, bEnd = aStart+prefix, aEnd-suffix, bStart+prefix, bEnd-suffix
+	switch {
+	case aStart == aEnd:
+		s.appendLines('+', s.b[bStart:bEnd])
+	case bStart == bEnd:
+		s.appendLines('-', s.a[aStart:aEnd])
+	default:
+		s.compare(aStart, x, bStart, y, aEnd-aStart+bEnd-bStart)
+		s.appendLines(' ', s.a[x:u])
+		s.compare(u, aEnd, v, bEnd, aEnd-aStart+bEnd-bStart)
+	}
+	s.appendLines(' ', s.a[aEnd:aEnd+suffix])
+	return true
+}
+
+func (s *script) appendLines(kind byte, lines []string) {
+	for _, line := range lines {
+		s.edits = append(s.edits, edit{kind: kind, line: line})
+	}
+}
+
+// middleSnake returns the middle snake (x, y) -> (u, v) of the shortest edit script transforming a[aStart:aEnd]
+// into b[bStart:bEnd], searching it from both ends at once. It returns false if the script is longer than maxEdits.
+func (s *script) middleSnake(aStart, aEnd, bStart, bEnd, maxEdits int) (x, y, u, v int, ok bool) {
+	n, m := aEnd-aStart, bEnd-bStart
+	delta := n - m
+	offset := n + m + 1
+	s.forward[offset+1] = 0
+	s.backward[offset+1] = 0
+	for d := 0; 2*d-1 <= maxEdits && d <= (n+m+1)/2; d++ {
+		for k := -d; k <= d; k += 2 {
+			var startX int
+			if k == -d || (k != d && s.forward[offset+k-1] < s.forward[offset+k+1]) {
+				startX = s.forward[offset+k+1] // insertion
+			} else {
+				startX = s.forward[offset+k-1] + 1 // deletion
+			}
+			endX := startX
+			for endX < n && endX-k < m && s.a[aStart+endX] == s.b[bStart+endX-k] {
+				endX++
+			}
+			s.forward[offset+k] = endX
+			// forward path on diagonal k meets backward path of d-1 edits on diagonal delta - k
+			if delta%2 != 0 && delta-k >= -(d-1) && delta-k <= d-1 && endX+s.backward[offset+delta-k] >= n {
+				return aStart + startX, bStart + startX - k, aStart + endX, bStart + endX - k, true
+			}
+		}
+		if 2*d > maxEdits {
+			break
+		}
+		for k := -d; k <= d; k += 2 {
+			var startX int
+			if k == -d || (k != d && s.backward[offset+k-1] < s.backward[offset+k+1]) {
+				startX = s.backward[offset+k+1]
+			} else {
+				startX = s.backward[offset+k-1] + 1
+			}
+			endX := startX
+			for endX < n && endX-k < m && s.a[aEnd-1-endX] == s.b[bEnd-1-endX+k] {
+				endX++
+			}
+			s.backward[offset+k] = endX
+			// backward path on diagonal k meets forward path of d edits on diagonal delta - k
+			if delta%2 == 0 && delta-k >= -d && delta-k <= d && endX+s.forward[offset+delta-k] >= n {
+				return aEnd - endX, bEnd - endX + k, aEnd - startX, bEnd - startX + k, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
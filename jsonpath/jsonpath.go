@@ -0,0 +1,113 @@
+// Package jsonpath selects values in json documents decoded by encoding/json with paths in subset of JSONPath notation:
+// $ (root), .name (object member), ["name"] or ['name'] (object member with any name) and [n] (array element,
+// negative n counts from the end). Wildcards, slices, recursive descent and filters are not supported.
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is parsed JSONPath
+type Path []step
+
+type step struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+func Parse(path string) (Path, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path %q does not start with $", path)
+	}
+	steps := Path{}
+	for rest := path[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("empty name in json path %q", path)
+			}
+			steps = append(steps, step{name: rest[1:end]})
+			rest = rest[end:]
+		case '[':
+			end := closingBracket(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in json path %q", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			if len(selector) >= 2 && selector[0] == '"' {
+				name, err := strconv.Unquote(selector)
+				if err != nil {
+					return nil, fmt.Errorf("invalid name %s in json path %q", selector, path)
+				}
+				steps = append(steps, step{name: name})
+			} else if len(selector) >= 2 && selector[0] == '\'' && selector[len(selector)-1] == '\'' {
+				steps = append(steps, step{name: selector[1 : len(selector)-1]})
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("invalid selector [%s] in json path %q - expected array index or quoted name", selector, path)
+				}
+				steps = append(steps, step{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q in json path %q", rest[0], path)
+		}
+	}
+	return steps, nil
+}
+
+// closingBracket returns index of ] which closes selector at the beginning of s (brackets in quoted names are skipped)
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == 0 && (s[i] == '"' || s[i] == '\''):
+			quote = s[i]
+		case quote == '"' && s[i] == '\\':
+			i++ // escaped character
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote == 0 && s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns value at path in json document, false if there is no such value
+func (p Path) Get(document interface{}) (interface{}, bool) {
+	value := document
+	for _, s := range p {
+		if s.isIndex {
+			array, ok := value.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			index := s.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index < 0 || index >= len(array) {
+				return nil, false
+			}
+			value = array[index]
+		} else {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[s.name]; !ok {
+				return nil, false
+			}
+		}
+	}
+	return value, true
+}
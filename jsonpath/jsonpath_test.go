@@ -0,0 +1,66 @@
+package jsonpath_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/jsonpath"
+)
+
+func TestParse(t *testing.T) {
+	for _, valid := range []string{
+		"$",
+		"$.status",
+		"$.items[0].name",
+		"$.items[-1]",
+		`$["content-type"]`,
+		`$['a.b']`,
+		`$["a]\"b"][2]`,
+	} {
+		_, err := jsonpath.Parse(valid)
+		assert.NoError(t, err, valid)
+	}
+	for _, invalid := range []string{
+		"",
+		"status",
+		"$.",
+		"$..a",
+		"$[",
+		"$[*]",
+		"$[1:2]",
+		`$["a]`,
+		"$a",
+	} {
+		_, err := jsonpath.Parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestGet(t *testing.T) {
+	var document interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"status":"up","items":[{"name":"a"},{"name":"b"}],"content-type":null,"a]\"b":[1,2,3]}`), &document))
+	for path, expected := range map[string]interface{}{
+		"$":                 document,
+		"$.status":          "up",
+		"$.items[0].name":   "a",
+		"$.items[-1]":       map[string]interface{}{"name": "b"},
+		`$["content-type"]`: nil,
+		`$['status']`:       "up",
+		`$["a]\"b"][2]`:     3.0,
+	} {
+		parsed, err := jsonpath.Parse(path)
+		require.NoError(t, err, path)
+		value, ok := parsed.Get(document)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, value, path)
+	}
+	for _, path := range []string{"$.missing", "$.items[2]", "$.items[-3]", "$.status.x", "$.items.name", "$[0]"} {
+		parsed, err := jsonpath.Parse(path)
+		require.NoError(t, err, path)
+		_, ok := parsed.Get(document)
+		assert.False(t, ok, path)
+	}
+}
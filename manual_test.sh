@@ -6,14 +6,38 @@ echo 'create urls which will fetch "abcdefghijklmno"'
 curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/range/15","interval":4}'
 curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/range/15","interval":2}'
 
+echo 'create url which will be fetched every 5 minutes during working hours in Warsaw'
+curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/range/15","schedule":{"cron":"*/5 9-17 * * MON-FRI","timezone":"Europe/Warsaw"}}'
+
 echo 'get all urls (rerun it later with more urls)'
 curl -si 127.0.0.1:8080/api/fetcher
 
 echo 'create url which will timeout'
 curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/delay/10","interval":5}'
 
-echo 'create url which will be unreachable'
-curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"http://nonexisting-url.com","interval":6}'
+echo 'create url which fails with 503 and is retried with exponential backoff'
+curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/status/503","interval":30,"retry":{"max_attempts":3,"base_delay":1}}'
+
+echo 'create url which will be unreachable - its interval is stretched up to 60s while it keeps failing'
+curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"http://nonexisting-url.com","interval":6,"backoff":{"max_interval":60}}'
+
+echo 'create url which records only changes - its history keeps one response with growing "unchanged" count'
+curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/range/15","interval":3,"record":"on_change"}'
+
+echo 'create url with assertions - see "assertions" in its history and "health" in all urls'
+curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/json","interval":10,"assertions":[{"status_codes":[200]},{"max_latency":0.5},{"json_path":"$.slideshow.author","equals":"Yours Truly"}]}'
+
+echo 'create url with webhook - body of uuid changes with each fetch, see GET /api/notifications/deliveries (they fail if nothing listens on port 9000)'
+curl -si 127.0.0.1:8080/api/fetcher -X POST -d '{"url":"https://httpbin.org/uuid","interval":10,"webhooks":[{"url":"http://127.0.0.1:9000/hook","secret":"s3cret"}]}'
+curl -s 127.0.0.1:8080/api/notifications/deliveries
+
+echo 'change interval of second url'
+curl -si 127.0.0.1:8080/api/fetcher/1 -X PATCH -d '{"interval":3}'
+
+echo 'pause second url (see "paused" in all urls) and resume it - its history is kept'
+curl -si 127.0.0.1:8080/api/fetcher/1/pause -X POST
+curl -s 127.0.0.1:8080/api/fetcher
+curl -si 127.0.0.1:8080/api/fetcher/1/resume -X POST
 
 echo 'delete first url'
 curl -s 127.0.0.1:8080/api/fetcher/0 -X DELETE
@@ -23,3 +47,17 @@ curl -s 127.0.0.1:8080/api/fetcher/0 -X DELETE
 
 echo 'get history (try it also with other urls)'
 curl -s 127.0.0.1:8080/api/fetcher/1/history
+
+echo 'get raw body of the first response of url 1'
+curl -si 127.0.0.1:8080/api/fetcher/1/history/1/body
+
+echo 'compare bodies of the first two responses of url 1'
+curl -s '127.0.0.1:8080/api/fetcher/1/diff?from=1&to=2'
+
+echo 'stream responses of url 1 (interrupt with Ctrl+C), then stream of all urls resumed after event 1'
+curl -sN 127.0.0.1:8080/api/fetcher/1/stream
+curl -sN 127.0.0.1:8080/api/fetcher/stream -H 'Last-Event-ID: 1'
+
+echo 'subscribe to responses of urls 0 and 1 over WebSocket (needs websocat, interrupt with Ctrl+C) and create another url'
+printf '%s\n' '{"id":1,"type":"subscribe","url_ids":[0,1]}' '{"id":2,"type":"create","url":{"url":"https://httpbin.org/uuid","interval":5}}' |
+  websocat -n ws://127.0.0.1:8080/api/fetcher/ws
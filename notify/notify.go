@@ -0,0 +1,291 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"fetcher/api"
+	"fetcher/clock"
+)
+
+// Notifier implements urls.Notifier by sending notifications to webhooks in POST requests with json body.
+// Each webhook has a queue of notifications delivered one by one in order of Notify calls by single sender goroutine,
+// which runs while the queue is not empty. Failed deliveries are retried with exponential backoff, holding back
+// the next ones. When too many notifications wait for a webhook, the oldest of them are dropped and marked failed.
+// Recent deliveries are kept in log (see GetDeliveries).
+type Notifier struct {
+	globalWebhooks []api.Webhook
+	maxAttempts    int
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	logSize        int
+	maxQueueSize   int
+	client         *http.Client
+	clock          clock.Clock // source of time for deliveries and their retries
+
+	mutex      sync.Mutex
+	deliveries []*api.Delivery   // oldest first
+	queues     map[string]*queue // by webhook url, only webhooks with undelivered notifications
+	nextId     uint64
+}
+
+// queue holds notifications waiting for delivery to webhook
+type queue struct {
+	pending []pendingDelivery
+}
+
+type pendingDelivery struct {
+	delivery *api.Delivery
+	webhook  api.Webhook
+	body     []byte
+}
+
+const (
+	DefaultMaxAttempts  = 5
+	DefaultBaseDelay    = time.Second
+	DefaultMaxDelay     = time.Minute
+	DefaultLogSize      = 1000
+	DefaultMaxQueueSize = 100
+	DefaultTimeout      = 10 * time.Second
+)
+
+// Headers of requests sent to webhooks
+const (
+	HeaderSignature = "X-Fetcher-Signature" // "sha256=" followed by hex of HMAC-SHA256 of body, only if webhook has secret
+	HeaderEvent     = "X-Fetcher-Event"
+	HeaderDelivery  = "X-Fetcher-Delivery" // id of delivery, the same in all attempts
+)
+
+type Option func(n *Notifier)
+
+// WithGlobalWebhooks makes notifier send notifications about all urls to given webhooks (besides webhooks of each url)
+func WithGlobalWebhooks(webhooks ...api.Webhook) Option {
+	return func(n *Notifier) {
+		n.globalWebhooks = append(n.globalWebhooks, webhooks...)
+	}
+}
+
+// WithRetry sets number of attempts to deliver each notification and delay before the first retry.
+// Delay doubles with each next retry, up to one minute.
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return func(n *Notifier) {
+		n.maxAttempts = maxAttempts
+		n.baseDelay = baseDelay
+	}
+}
+
+// WithLogSize sets number of the most recent deliveries returned by GetDeliveries
+func WithLogSize(size int) Option {
+	return func(n *Notifier) {
+		n.logSize = size
+	}
+}
+
+// WithMaxQueueSize sets number of notifications which may wait for delivery to single webhook (besides the one being
+// delivered). When the queue is full, the oldest waiting notification is dropped to make room for the new one.
+func WithMaxQueueSize(size int) Option {
+	return func(n *Notifier) {
+		n.maxQueueSize = size
+	}
+}
+
+// WithClient replaces http client used to make requests to webhooks
+func WithClient(client *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = client
+	}
+}
+
+// WithClock replaces real time used for delays of retries and times of attempts, e.g. with virtual time in tests
+func WithClock(clock clock.Clock) Option {
+	return func(n *Notifier) {
+		n.clock = clock
+	}
+}
+
+func New(options ...Option) *Notifier {
+	n := &Notifier{
+		maxAttempts:  DefaultMaxAttempts,
+		baseDelay:    DefaultBaseDelay,
+		maxDelay:     DefaultMaxDelay,
+		logSize:      DefaultLogSize,
+		maxQueueSize: DefaultMaxQueueSize,
+		client:       &http.Client{Timeout: DefaultTimeout},
+		clock:        clock.Real{},
+		queues:       make(map[string]*queue),
+	}
+	for _, option := range options {
+		option(n)
+	}
+	return n
+}
+
+// Notify queues notification for delivery to given webhooks and global ones. It does not wait for deliveries.
+func (n *Notifier) Notify(notification api.Notification, webhooks []api.Webhook) {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		log.Printf("could not encode notification about url %d: %s", notification.UrlId, err)
+		return
+	}
+	targets := append(append([]api.Webhook(nil), webhooks...), n.globalWebhooks...)
+	for _, webhook := range targets {
+		delivery := n.addDelivery(notification, webhook)
+		n.enqueue(pendingDelivery{delivery: delivery, webhook: webhook, body: body})
+	}
+}
+
+// enqueue adds delivery to queue of its webhook and starts sender of the queue if it is not running.
+// The oldest waiting deliveries are dropped if the queue is full.
+func (n *Notifier) enqueue(p pendingDelivery) {
+	key := p.webhook.Url.String()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	q, ok := n.queues[key]
+	if !ok {
+		q = &queue{}
+		n.queues[key] = q
+		go n.send(key, q)
+	}
+	for len(q.pending) > 0 && len(q.pending) >= n.maxQueueSize {
+		dropped := q.pending[0].delivery
+		dropped.Status = api.DeliveryFailed
+		dropped.Error = "dropped because too many notifications wait for webhook"
+		q.pending[0] = pendingDelivery{}
+		q.pending = q.pending[1:]
+	}
+	q.pending = append(q.pending, p)
+}
+
+// send delivers notifications in queue until it is empty
+func (n *Notifier) send(key string, q *queue) {
+	for {
+		n.mutex.Lock()
+		if len(q.pending) == 0 {
+			delete(n.queues, key)
+			n.mutex.Unlock()
+			return
+		}
+		p := q.pending[0]
+		q.pending[0] = pendingDelivery{}
+		q.pending = q.pending[1:]
+		n.mutex.Unlock()
+		n.deliver(p.delivery, p.webhook, p.body)
+	}
+}
+
+func (n *Notifier) addDelivery(notification api.Notification, webhook api.Webhook) *api.Delivery {
+	webhookUrl := *webhook.Url
+	webhookUrl.User = nil
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.nextId++
+	delivery := &api.Delivery{
+		Id:        n.nextId,
+		UrlId:     notification.UrlId,
+		Event:     notification.Event,
+		Webhook:   webhookUrl.String(),
+		Status:    api.DeliveryPending,
+		CreatedAt: notification.CreatedAt,
+	}
+	n.deliveries = append(n.deliveries, delivery)
+	if len(n.deliveries) > n.logSize {
+		n.deliveries[0] = nil
+		n.deliveries = n.deliveries[1:]
+	}
+	return delivery
+}
+
+// deliver makes requests to webhook until one succeeds or attempts run out
+func (n *Notifier) deliver(delivery *api.Delivery, webhook api.Webhook, body []byte) {
+	for attempt := 1; ; attempt++ {
+		statusCode, err := n.post(delivery, webhook, body)
+		n.mutex.Lock()
+		delivery.Attempts = attempt
+		delivery.LastAttempt = n.clock.Now()
+		delivery.StatusCode = statusCode
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		switch {
+		case err == nil:
+			delivery.Status = api.DeliveryDelivered
+		case attempt >= n.maxAttempts:
+			delivery.Status = api.DeliveryFailed
+		}
+		n.mutex.Unlock()
+		if err == nil || attempt >= n.maxAttempts {
+			return
+		}
+		timer, stopTimer := n.clock.Timer(n.clock.Now().Add(n.retryDelay(attempt)))
+		<-timer
+		stopTimer()
+	}
+}
+
+// retryDelay returns delay after given failed attempt
+func (n *Notifier) retryDelay(attempt int) time.Duration {
+	delay := n.baseDelay
+	for i := 1; i < attempt && delay < n.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > n.maxDelay {
+		delay = n.maxDelay
+	}
+	return delay
+}
+
+// post makes single request to webhook and returns its http status (0 if there is no response)
+func (n *Notifier) post(delivery *api.Delivery, webhook api.Webhook, body []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, webhook.Url.String(), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEvent, delivery.Event)
+	request.Header.Set(HeaderDelivery, strconv.FormatUint(delivery.Id, 10))
+	if webhook.Secret != "" {
+		request.Header.Set(HeaderSignature, Signature(webhook.Secret, body))
+	}
+	response, err := n.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 1<<16)) // lets client reuse connection
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// Signature returns value of HeaderSignature for body signed with secret
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetDeliveries implements api.DeliveryLogSource
+func (n *Notifier) GetDeliveries(urlId *uint64) []api.Delivery {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	deliveries := []api.Delivery{}
+	for i := len(n.deliveries) - 1; i >= 0; i-- {
+		if urlId == nil || n.deliveries[i].UrlId == *urlId {
+			deliveries = append(deliveries, *n.deliveries[i])
+		}
+	}
+	return deliveries
+}
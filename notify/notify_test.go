@@ -0,0 +1,329 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/notify"
+)
+
+// receiver records requests made to webhook and fails the first failures of them
+type receiver struct {
+	mutex    sync.Mutex
+	failures int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (r *receiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body, _ := ioutil.ReadAll(request.Body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, receivedRequest{header: request.Header, body: body})
+	if len(r.requests) <= r.failures {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+// fakeClock moves only when Advance is called
+type fakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers map[chan time.Time]time.Time // deadlines of waiting timers
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1600000000, 0), timers: make(map[chan time.Time]time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Timer(deadline time.Time) (<-chan time.Time, func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	timer := make(chan time.Time, 1)
+	if deadline.After(c.now) {
+		c.timers[timer] = deadline
+	} else {
+		timer <- c.now
+	}
+	return timer, func() {
+		c.mutex.Lock()
+		delete(c.timers, timer)
+		c.mutex.Unlock()
+	}
+}
+
+// Advance moves time after waiting for timer with deadline at the new time
+func (c *fakeClock) Advance(t *testing.T, d time.Duration) {
+	require.Eventually(t, func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for _, deadline := range c.timers {
+			if deadline.Equal(c.now.Add(d)) {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, time.Millisecond, "no timer for %s", d)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	for timer, deadline := range c.timers {
+		if !deadline.After(c.now) {
+			timer <- c.now
+			delete(c.timers, timer)
+		}
+	}
+}
+
+func newWebhook(t *testing.T, serverUrl string, secret string) api.Webhook {
+	u, err := url.Parse(serverUrl)
+	require.NoError(t, err)
+	return api.Webhook{Url: u, Secret: secret}
+}
+
+// waitForDelivery waits until the newest delivery is not pending anymore and returns it
+func waitForDelivery(t *testing.T, notifier *notify.Notifier) api.Delivery {
+	var delivery api.Delivery
+	require.Eventually(t, func() bool {
+		deliveries := notifier.GetDeliveries(nil)
+		if len(deliveries) == 0 {
+			return false
+		}
+		delivery = deliveries[0]
+		return delivery.Status != api.DeliveryPending
+	}, 5*time.Second, time.Millisecond)
+	return delivery
+}
+
+var notification = api.Notification{
+	Event:      api.EventDown,
+	UrlId:      3,
+	Url:        "https://example.com/status",
+	Seq:        7,
+	CreatedAt:  time.Unix(1600000000, 0),
+	StatusCode: 503,
+	Error:      api.FetchErrorStatus,
+}
+
+func TestNotifier(t *testing.T) {
+	t.Run("sends signed notification", func(t *testing.T) {
+		r := &receiver{}
+		server := httptest.NewServer(r)
+		defer server.Close()
+		notifier := notify.New()
+
+		notifier.Notify(notification, []api.Webhook{newWebhook(t, server.URL, "s3cret")})
+		delivery := waitForDelivery(t, notifier)
+		assert.Equal(t, api.DeliveryDelivered, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusOK, delivery.StatusCode)
+
+		requests := r.received()
+		require.Len(t, requests, 1)
+		body := requests[0].body
+		assert.JSONEq(t, `{"event":"down","url_id":3,"url":"https://example.com/status","seq":7,"created_at":1600000000,"status_code":503,"error":"status"}`, string(body))
+		assert.Equal(t, notify.Signature("s3cret", body), requests[0].header.Get(notify.HeaderSignature))
+		assert.Equal(t, "sha256=", notify.Signature("s3cret", body)[:7])
+		assert.Equal(t, api.EventDown, requests[0].header.Get(notify.HeaderEvent))
+		assert.Equal(t, "1", requests[0].header.Get(notify.HeaderDelivery))
+		assert.Equal(t, "application/json", requests[0].header.Get("Content-Type"))
+	})
+
+	t.Run("does not sign notification without secret", func(t *testing.T) {
+		r := &receiver{}
+		server := httptest.NewServer(r)
+		defer server.Close()
+		notifier := notify.New()
+
+		notifier.Notify(notification, []api.Webhook{newWebhook(t, server.URL, "")})
+		waitForDelivery(t, notifier)
+		requests := r.received()
+		require.Len(t, requests, 1)
+		assert.Empty(t, requests[0].header.Get(notify.HeaderSignature))
+	})
+
+	t.Run("retries failed delivery with exponential backoff", func(t *testing.T) {
+		r := &receiver{failures: 2}
+		server := httptest.NewServer(r)
+		defer server.Close()
+		clock := newFakeClock()
+		start := clock.Now()
+		notifier := notify.New(notify.WithRetry(3, time.Second), notify.WithClock(clock))
+
+		notifier.Notify(notification, []api.Webhook{newWebhook(t, server.URL, "")})
+		clock.Advance(t, time.Second)
+		clock.Advance(t, 2*time.Second)
+		delivery := waitForDelivery(t, notifier)
+		assert.Equal(t, api.DeliveryDelivered, delivery.Status)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.Equal(t, start.Add(3*time.Second), delivery.LastAttempt)
+		assert.Empty(t, delivery.Error)
+		requests := r.received()
+		require.Len(t, requests, 3)
+		for _, request := range requests {
+			assert.Equal(t, "1", request.header.Get(notify.HeaderDelivery))
+		}
+	})
+
+	t.Run("marks delivery failed after the last attempt", func(t *testing.T) {
+		r := &receiver{failures: 5}
+		server := httptest.NewServer(r)
+		defer server.Close()
+		clock := newFakeClock()
+		notifier := notify.New(notify.WithRetry(2, time.Second), notify.WithClock(clock))
+
+		notifier.Notify(notification, []api.Webhook{newWebhook(t, server.URL, "")})
+		clock.Advance(t, time.Second)
+		delivery := waitForDelivery(t, notifier)
+		assert.Equal(t, api.DeliveryFailed, delivery.Status)
+		assert.Equal(t, 2, delivery.Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.StatusCode)
+		assert.Equal(t, "webhook responded with status 503", delivery.Error)
+		assert.Len(t, r.received(), 2)
+	})
+
+	t.Run("delivers notifications to webhook in order", func(t *testing.T) {
+		r := &receiver{failures: 1}
+		server := httptest.NewServer(r)
+		defer server.Close()
+		clock := newFakeClock()
+		notifier := notify.New(notify.WithClock(clock))
+
+		webhooks := []api.Webhook{newWebhook(t, server.URL, "")}
+		for seq := uint64(1); seq <= 3; seq++ {
+			n := notification
+			n.Seq = seq
+			notifier.Notify(n, webhooks)
+		}
+		clock.Advance(t, time.Second) // the first delivery holds back the next ones until its retry
+		require.Eventually(t, func() bool {
+			return len(r.received()) == 4
+		}, 5*time.Second, time.Millisecond)
+		var seqs []uint64
+		for _, request := range r.received() {
+			var received struct {
+				Seq uint64 `json:"seq"`
+			}
+			require.NoError(t, json.Unmarshal(request.body, &received))
+			seqs = append(seqs, received.Seq)
+		}
+		assert.Equal(t, []uint64{1, 1, 2, 3}, seqs)
+	})
+
+	t.Run("drops the oldest notifications when queue of webhook is full", func(t *testing.T) {
+		r := &receiver{failures: 1}
+		server := httptest.NewServer(r)
+		defer server.Close()
+		clock := newFakeClock()
+		notifier := notify.New(notify.WithMaxQueueSize(2), notify.WithClock(clock))
+
+		webhooks := []api.Webhook{newWebhook(t, server.URL, "")}
+		notifier.Notify(notification, webhooks)
+		require.Eventually(t, func() bool {
+			return len(r.received()) == 1
+		}, 5*time.Second, time.Millisecond)
+		for seq := uint64(2); seq <= 4; seq++ { // queued while the first delivery waits for retry
+			n := notification
+			n.Seq = seq
+			notifier.Notify(n, webhooks)
+		}
+		deliveries := notifier.GetDeliveries(nil)
+		require.Len(t, deliveries, 4)
+		dropped := deliveries[2]
+		assert.Equal(t, uint64(2), dropped.Id)
+		assert.Equal(t, api.DeliveryFailed, dropped.Status)
+		assert.Equal(t, 0, dropped.Attempts)
+		assert.Equal(t, "dropped because too many notifications wait for webhook", dropped.Error)
+
+		clock.Advance(t, time.Second)
+		require.Eventually(t, func() bool {
+			return len(r.received()) == 4
+		}, 5*time.Second, time.Millisecond)
+		var seqs []uint64
+		for _, request := range r.received() {
+			var received struct {
+				Seq uint64 `json:"seq"`
+			}
+			require.NoError(t, json.Unmarshal(request.body, &received))
+			seqs = append(seqs, received.Seq)
+		}
+		assert.Equal(t, []uint64{7, 7, 3, 4}, seqs)
+	})
+
+	t.Run("sends notifications to global webhooks", func(t *testing.T) {
+		urlReceiver, globalReceiver := &receiver{}, &receiver{}
+		urlServer, globalServer := httptest.NewServer(urlReceiver), httptest.NewServer(globalReceiver)
+		defer urlServer.Close()
+		defer globalServer.Close()
+		global := newWebhook(t, globalServer.URL, "")
+		global.Url.User = url.UserPassword("user", "password")
+		notifier := notify.New(notify.WithGlobalWebhooks(global))
+
+		notifier.Notify(notification, []api.Webhook{newWebhook(t, urlServer.URL, "")})
+		notifier.Notify(api.Notification{Event: api.EventUp, UrlId: 4}, nil)
+		require.Eventually(t, func() bool {
+			return len(urlReceiver.received()) == 1 && len(globalReceiver.received()) == 2
+		}, 5*time.Second, time.Millisecond)
+
+		id := uint64(3)
+		deliveries := notifier.GetDeliveries(&id)
+		require.Len(t, deliveries, 2)
+		webhooks := []string{deliveries[0].Webhook, deliveries[1].Webhook}
+		assert.ElementsMatch(t, []string{urlServer.URL, globalServer.URL}, webhooks) // without credentials
+		deliveries = notifier.GetDeliveries(nil)
+		require.Len(t, deliveries, 3)
+		assert.Equal(t, uint64(4), deliveries[0].UrlId) // newest first
+	})
+
+	t.Run("keeps limited number of deliveries", func(t *testing.T) {
+		r := &receiver{}
+		server := httptest.NewServer(r)
+		defer server.Close()
+		notifier := notify.New(notify.WithLogSize(2))
+
+		for i := 0; i < 3; i++ {
+			n := notification
+			n.Seq = uint64(i)
+			notifier.Notify(n, []api.Webhook{newWebhook(t, server.URL, "")})
+		}
+		deliveries := notifier.GetDeliveries(nil)
+		require.Len(t, deliveries, 2)
+		assert.Equal(t, uint64(3), deliveries[0].Id)
+		assert.Equal(t, uint64(2), deliveries[1].Id)
+		require.Eventually(t, func() bool {
+			return len(r.received()) == 3
+		}, 5*time.Second, time.Millisecond)
+	})
+
+	t.Run("GetDeliveries returns empty list", func(t *testing.T) {
+		deliveries, err := json.Marshal(notify.New().GetDeliveries(nil))
+		require.NoError(t, err)
+		assert.Equal(t, "[]", string(deliveries))
+	})
+}
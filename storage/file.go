@@ -0,0 +1,549 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"fetcher/api"
+	"fetcher/urls"
+)
+
+// File is urls.Storage implemented as append-only log of json records (one record per line).
+// Log is replayed and compacted when the file is opened, so it contains only live data after each restart.
+// While file is open, it counts records which are live (needed to restore state) and log is compacted again
+// when most of its records are dead (e.g. evicted responses or deleted urls).
+type File struct {
+	path               string
+	compactionInterval int
+
+	mutex   sync.Mutex
+	file    *os.File
+	loaded  urls.StoredState
+	live    *liveRecords
+	records int // number of records in file
+	written int // number of records written since live records were counted
+}
+
+// DefaultCompactionInterval is number of written records after which share of dead records in log is checked
+const DefaultCompactionInterval = 1000
+
+type Option func(f *File)
+
+// WithCompactionInterval sets number of written records after which share of dead records in log is checked
+// and log is compacted if more than half of records are dead
+func WithCompactionInterval(records int) Option {
+	return func(f *File) {
+		f.compactionInterval = records
+	}
+}
+
+const (
+	opNextId    = "next_id"
+	opSaveUrl   = "save_url"
+	opDeleteUrl = "delete_url"
+	opPause     = "pause_url"
+	opResume    = "resume_url"
+	opResponse  = "response"
+	opUpdate    = "update_response"
+	opEvict     = "evict"
+	opBody      = "body"
+)
+
+type record struct {
+	Op       string          `json:"op"`
+	UrlId    uint64          `json:"url_id,omitempty"`
+	NextId   uint64          `json:"next_id,omitempty"`
+	Count    int             `json:"count,omitempty"`
+	Url      *api.NewUrl     `json:"url,omitempty"`
+	Response *storedResponse `json:"response,omitempty"`
+	Hash     string          `json:"hash,omitempty"`
+	Body     []byte          `json:"body,omitempty"`
+}
+
+// storedResponse has the same fields as api.UrlResponse, but without its custom (lossy) MarshalJSON.
+// Body is stored in base64 as "body" - "response" (text) is present only in files written before bodies were binary-safe.
+// Responses with hash do not contain body, it is stored once in separate record and shared by all responses with the hash.
+type storedResponse struct {
+	responseFields
+	Body     []byte  `json:"body"`
+	TextBody *string `json:"response,omitempty"` // hides responseFields.Response
+}
+
+type responseFields api.UrlResponse
+
+func newStoredResponse(response api.UrlResponse) *storedResponse {
+	stored := &storedResponse{responseFields: responseFields(response)}
+	if response.Hash == "" {
+		stored.Body = response.Response
+	}
+	return stored
+}
+
+// toApi returns response with body taken from bodies (by hash) or from the response itself
+func (s *storedResponse) toApi(bodies map[string][]byte) (api.UrlResponse, error) {
+	response := api.UrlResponse(s.responseFields)
+	response.Response = s.Body
+	if s.TextBody != nil {
+		response.Response = []byte(*s.TextBody)
+	}
+	if response.Hash != "" {
+		body, ok := bodies[response.Hash]
+		if !ok {
+			return api.UrlResponse{}, fmt.Errorf("body with hash %s not found", response.Hash)
+		}
+		response.Response = body
+	}
+	return response, nil
+}
+
+func OpenFile(path string, options ...Option) (*File, error) {
+	replayed, err := replay(path)
+	if err != nil {
+		return nil, err
+	}
+	state := replayed.storedState()
+	records, err := compact(path, state)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{path: path, compactionInterval: DefaultCompactionInterval, file: file, loaded: state, live: newLiveRecords(state), records: records}
+	for _, option := range options {
+		option(f)
+	}
+	return f, nil
+}
+
+func (f *File) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Close()
+}
+
+// Load returns state read from file when it was opened
+func (f *File) Load() (urls.StoredState, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.loaded, nil
+}
+
+func (f *File) SaveNextId(nextId uint64) error {
+	return f.write(record{Op: opNextId, NextId: nextId})
+}
+
+func (f *File) SaveUrl(urlId uint64, url api.NewUrl) error {
+	return f.write(record{Op: opSaveUrl, UrlId: urlId, Url: &url})
+}
+
+func (f *File) DeleteUrl(urlId uint64) error {
+	return f.write(record{Op: opDeleteUrl, UrlId: urlId})
+}
+
+func (f *File) SavePaused(urlId uint64, paused bool) error {
+	if paused {
+		return f.write(record{Op: opPause, UrlId: urlId})
+	}
+	return f.write(record{Op: opResume, UrlId: urlId})
+}
+
+func (f *File) SaveBody(hash string, body []byte) error {
+	return f.write(record{Op: opBody, Hash: hash, Body: body})
+}
+
+func (f *File) SaveResponse(urlId uint64, response api.UrlResponse) error {
+	return f.write(record{Op: opResponse, UrlId: urlId, Response: newStoredResponse(response)})
+}
+
+func (f *File) UpdateResponse(urlId uint64, response api.UrlResponse) error {
+	return f.write(record{Op: opUpdate, UrlId: urlId, Response: newStoredResponse(response)})
+}
+
+func (f *File) EvictResponses(urlId uint64, count int) error {
+	return f.write(record{Op: opEvict, UrlId: urlId, Count: count})
+}
+
+func (f *File) write(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	f.records++
+	f.written++
+	f.live.apply(r)
+	// body is saved right before the first response which has it, compaction would drop it as unreferenced
+	if f.written >= f.compactionInterval && r.Op != opBody {
+		f.written = 0
+		if f.records > 2*f.live.records() {
+			f.compact()
+		}
+	}
+	return nil
+}
+
+// compact replays log, rewrites it with live records and continues writing to the new file.
+// If it fails, the old file is used. It must be called with File.mutex locked.
+func (f *File) compact() {
+	replayed, err := replay(f.path)
+	if err != nil {
+		log.Printf("could not replay %s for compaction: %s", f.path, err)
+		return
+	}
+	state := replayed.storedState()
+	records, err := compact(f.path, state)
+	if err != nil {
+		log.Printf("could not compact %s: %s", f.path, err)
+		return
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("could not open compacted %s: %s", f.path, err)
+		return
+	}
+	if err := f.file.Close(); err != nil {
+		log.Printf("could not close %s before compaction: %s", f.path, err)
+	}
+	f.file = file
+	f.records = records
+	f.live = newLiveRecords(state)
+}
+
+// liveRecords tracks which records of log are live without keeping responses and bodies themselves
+type liveRecords struct {
+	urls   map[uint64]*liveUrl
+	bodies map[string]int // number of live responses with body of given hash
+}
+
+type liveUrl struct {
+	paused    bool
+	responses []liveResponse // ordered by CreatedAt, like responses in state
+}
+
+type liveResponse struct {
+	seq       uint64
+	createdAt time.Time
+	hash      string
+}
+
+func newLiveRecords(state urls.StoredState) *liveRecords {
+	l := &liveRecords{urls: make(map[uint64]*liveUrl, len(state.Urls)), bodies: make(map[string]int)}
+	for _, storedUrl := range state.Urls {
+		u := &liveUrl{paused: storedUrl.Paused, responses: make([]liveResponse, 0, len(storedUrl.Responses))}
+		for _, response := range storedUrl.Responses {
+			l.insert(u, response)
+		}
+		l.urls[storedUrl.Id] = u
+	}
+	return l
+}
+
+// apply updates live records after record is written, it mirrors applyRecord
+func (l *liveRecords) apply(r record) {
+	u, ok := l.urls[r.UrlId]
+	switch r.Op {
+	case opSaveUrl:
+		if !ok && r.Url != nil {
+			l.urls[r.UrlId] = &liveUrl{}
+		}
+	case opDeleteUrl:
+		if ok {
+			l.evict(u, len(u.responses))
+			delete(l.urls, r.UrlId)
+		}
+	case opPause, opResume:
+		if ok {
+			u.paused = r.Op == opPause
+		}
+	case opResponse:
+		if ok && r.Response != nil {
+			l.insert(u, api.UrlResponse(r.Response.responseFields))
+		}
+	case opUpdate:
+		if !ok || r.Response == nil {
+			return
+		}
+		for i := range u.responses {
+			if u.responses[i].seq == r.Response.Seq {
+				l.release(u.responses[i].hash)
+				u.responses[i].hash = r.Response.Hash
+				l.reference(r.Response.Hash)
+			}
+		}
+	case opEvict:
+		if ok {
+			l.evict(u, r.Count)
+		}
+	}
+}
+
+func (l *liveRecords) insert(u *liveUrl, response api.UrlResponse) {
+	i := len(u.responses)
+	for i > 0 && response.CreatedAt.Before(u.responses[i-1].createdAt) {
+		i--
+	}
+	u.responses = append(u.responses, liveResponse{})
+	copy(u.responses[i+1:], u.responses[i:])
+	u.responses[i] = liveResponse{seq: response.Seq, createdAt: response.CreatedAt, hash: response.Hash}
+	l.reference(response.Hash)
+}
+
+// evict removes given number of the oldest responses
+func (l *liveRecords) evict(u *liveUrl, count int) {
+	if count > len(u.responses) {
+		count = len(u.responses)
+	}
+	for _, response := range u.responses[:count] {
+		l.release(response.hash)
+	}
+	u.responses = append([]liveResponse(nil), u.responses[count:]...)
+}
+
+func (l *liveRecords) reference(hash string) {
+	if hash != "" {
+		l.bodies[hash]++
+	}
+}
+
+func (l *liveRecords) release(hash string) {
+	if hash == "" {
+		return
+	}
+	if l.bodies[hash]--; l.bodies[hash] <= 0 {
+		delete(l.bodies, hash)
+	}
+}
+
+// records returns number of records needed to restore state, i.e. written by compaction
+func (l *liveRecords) records() int {
+	records := 1 + len(l.bodies)
+	for _, u := range l.urls {
+		records += 1 + len(u.responses)
+		if u.paused {
+			records++
+		}
+	}
+	return records
+}
+
+// logState is state restored from records
+type logState struct {
+	nextId uint64
+	urlMap map[uint64]*urls.StoredUrl
+	bodies map[string][]byte // including bodies of removed responses until they are pruned
+}
+
+func (s *logState) apply(r record) error {
+	return applyRecord(r, s.urlMap, s.bodies, &s.nextId)
+}
+
+// storedState returns state sorted by url id
+func (s *logState) storedState() urls.StoredState {
+	state := urls.StoredState{NextId: s.nextId, Urls: make([]urls.StoredUrl, 0, len(s.urlMap))}
+	for _, storedUrl := range s.urlMap {
+		hashBodies(storedUrl.Responses, s.bodies)
+		state.Urls = append(state.Urls, *storedUrl)
+	}
+	sort.Slice(state.Urls, func(i, j int) bool {
+		return state.Urls[i].Id < state.Urls[j].Id
+	})
+	return state
+}
+
+// pruneBodies removes bodies which are not referenced by any response
+func (s *logState) pruneBodies() {
+	referenced := make(map[string][]byte)
+	for _, storedUrl := range s.urlMap {
+		for _, response := range storedUrl.Responses {
+			if response.Hash != "" {
+				referenced[response.Hash] = s.bodies[response.Hash]
+			}
+		}
+	}
+	s.bodies = referenced
+}
+
+func replay(path string) (*logState, error) {
+	s := &logState{urlMap: make(map[uint64]*urls.StoredUrl), bodies: make(map[string][]byte)}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+		if readErr == io.EOF && len(line) == 0 {
+			break
+		}
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			if readErr == io.EOF {
+				break // last record was not written completely (e.g. server was killed) - skip it
+			}
+			return nil, fmt.Errorf("invalid record in line %d of %s: %s", lineNumber, path, err)
+		}
+		if err := s.apply(r); err != nil {
+			return nil, fmt.Errorf("invalid record in line %d of %s: %s", lineNumber, path, err)
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	s.pruneBodies()
+	return s, nil
+}
+
+func applyRecord(r record, urlMap map[uint64]*urls.StoredUrl, bodies map[string][]byte, nextId *uint64) error {
+	switch r.Op {
+	case opNextId:
+		if r.NextId > *nextId {
+			*nextId = r.NextId
+		}
+	case opSaveUrl:
+		if r.Url == nil {
+			return nil
+		}
+		if storedUrl, ok := urlMap[r.UrlId]; ok {
+			storedUrl.Url = *r.Url
+		} else {
+			urlMap[r.UrlId] = &urls.StoredUrl{Id: r.UrlId, Url: *r.Url}
+		}
+	case opDeleteUrl:
+		delete(urlMap, r.UrlId)
+	case opPause, opResume:
+		if storedUrl, ok := urlMap[r.UrlId]; ok {
+			storedUrl.Paused = r.Op == opPause
+		}
+	case opResponse:
+		storedUrl, ok := urlMap[r.UrlId]
+		if !ok || r.Response == nil {
+			return nil
+		}
+		response, err := r.Response.toApi(bodies)
+		if err != nil {
+			return err
+		}
+		storedUrl.Responses = urls.InsertResponse(storedUrl.Responses, response)
+	case opUpdate:
+		storedUrl, ok := urlMap[r.UrlId]
+		if !ok || r.Response == nil {
+			return nil
+		}
+		response, err := r.Response.toApi(bodies)
+		if err != nil {
+			return err
+		}
+		for i := range storedUrl.Responses {
+			if storedUrl.Responses[i].Seq == response.Seq {
+				storedUrl.Responses[i] = response
+			}
+		}
+	case opEvict:
+		storedUrl, ok := urlMap[r.UrlId]
+		if !ok {
+			return nil
+		}
+		if r.Count >= len(storedUrl.Responses) {
+			storedUrl.Responses = nil
+		} else {
+			storedUrl.Responses = storedUrl.Responses[r.Count:]
+		}
+	case opBody:
+		if r.Hash == "" {
+			return nil
+		}
+		body := r.Body
+		if body == nil {
+			body = []byte{} // empty body is omitted in record
+		}
+		bodies[r.Hash] = body
+	}
+	return nil
+}
+
+// hashBodies sets hash of responses stored before bodies were deduplicated, so that compaction stores their bodies once
+func hashBodies(responses []api.UrlResponse, bodies map[string][]byte) {
+	for i := range responses {
+		response := &responses[i]
+		if response.Response == nil || response.Hash != "" {
+			continue
+		}
+		response.Hash = urls.BodyHash(response.Response)
+		if body, ok := bodies[response.Hash]; ok {
+			response.Response = body
+		} else {
+			bodies[response.Hash] = response.Response
+		}
+	}
+}
+
+// compact rewrites file so that it contains only records needed to restore given state. It returns number of records.
+func compact(path string, state urls.StoredState) (int, error) {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	records := 0
+	encode := func(r record) error {
+		records++
+		return encoder.Encode(r)
+	}
+	err = encode(record{Op: opNextId, NextId: state.NextId})
+	writtenBodies := make(map[string]bool)
+	for i := 0; err == nil && i < len(state.Urls); i++ {
+		storedUrl := &state.Urls[i]
+		err = encode(record{Op: opSaveUrl, UrlId: storedUrl.Id, Url: &storedUrl.Url})
+		if err == nil && storedUrl.Paused {
+			err = encode(record{Op: opPause, UrlId: storedUrl.Id})
+		}
+		for j := 0; err == nil && j < len(storedUrl.Responses); j++ {
+			response := storedUrl.Responses[j]
+			if response.Hash != "" && !writtenBodies[response.Hash] {
+				writtenBodies[response.Hash] = true
+				if err = encode(record{Op: opBody, Hash: response.Hash, Body: response.Response}); err != nil {
+					break
+				}
+			}
+			err = encode(record{Op: opResponse, UrlId: storedUrl.Id, Response: newStoredResponse(response)})
+		}
+	}
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	return records, os.Rename(tmpPath, path)
+}
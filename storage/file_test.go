@@ -0,0 +1,276 @@
+package storage_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/storage"
+	"fetcher/urls"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetcher-storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "storage.log")
+	u, err := url.Parse("https://httpbin.org/range/15")
+	require.NoError(t, err)
+	response := api.UrlResponse{
+		Response:  []byte("abc"),
+		Hash:      urls.BodyHash([]byte("abc")),
+		Duration:  1234567,
+		CreatedAt: time.Unix(1500000000, 123).UTC(),
+	}
+
+	t.Run("OpenFile on non-existing file returns empty state", func(t *testing.T) {
+		file, err := storage.OpenFile(path)
+		require.NoError(t, err)
+		state, err := file.Load()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), state.NextId)
+		assert.Empty(t, state.Urls)
+		require.NoError(t, file.SaveNextId(1))
+		require.NoError(t, file.SaveUrl(0, api.NewUrl{Url: u, IntervalSeconds: 5}))
+		require.NoError(t, file.SaveNextId(2))
+		require.NoError(t, file.SaveUrl(1, api.NewUrl{Url: u, IntervalSeconds: 6}))
+		require.NoError(t, file.SaveResponse(0, api.UrlResponse{Duration: 2, CreatedAt: time.Unix(1400000000, 0).UTC()}))
+		require.NoError(t, file.SaveBody(response.Hash, response.Response))
+		require.NoError(t, file.SaveResponse(0, response))
+		require.NoError(t, file.EvictResponses(0, 1))
+		require.NoError(t, file.SaveResponse(1, api.UrlResponse{Duration: 5, CreatedAt: time.Unix(1500000006, 0).UTC()}))
+		require.NoError(t, file.DeleteUrl(1))
+		require.NoError(t, file.Close())
+	})
+
+	t.Run("OpenFile restores saved state", func(t *testing.T) {
+		file, err := storage.OpenFile(path)
+		require.NoError(t, err)
+		defer file.Close()
+		state, err := file.Load()
+		require.NoError(t, err)
+		expectedState := urls.StoredState{
+			NextId: 2,
+			Urls: []urls.StoredUrl{
+				{
+					Id:        0,
+					Url:       api.NewUrl{Url: u, IntervalSeconds: 5},
+					Responses: []api.UrlResponse{response},
+				},
+			},
+		}
+		assert.Equal(t, expectedState, state)
+	})
+
+	t.Run("OpenFile skips incomplete last record", func(t *testing.T) {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(`{"op":"response","url_id":0,"resp`))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+		fileStorage, err := storage.OpenFile(path)
+		require.NoError(t, err)
+		defer fileStorage.Close()
+		state, err := fileStorage.Load()
+		require.NoError(t, err)
+		require.Len(t, state.Urls, 1)
+		assert.Len(t, state.Urls[0].Responses, 1)
+	})
+
+	t.Run("OpenFile restores binary and empty bodies", func(t *testing.T) {
+		binaryPath := filepath.Join(dir, "binary.log")
+		file, err := storage.OpenFile(binaryPath)
+		require.NoError(t, err)
+		require.NoError(t, file.SaveUrl(0, api.NewUrl{Url: u, IntervalSeconds: 5}))
+		responses := []api.UrlResponse{
+			{Response: []byte{0x89, 'P', 'N', 'G', 0, 0xff}, ContentType: "image/png", CreatedAt: time.Unix(1500000000, 0).UTC()},
+			{Response: []byte{}, CreatedAt: time.Unix(1500000001, 0).UTC()},
+			{Error: api.FetchErrorTimeout, CreatedAt: time.Unix(1500000002, 0).UTC()},
+		}
+		for i, response := range responses {
+			if response.Response != nil {
+				responses[i].Hash = urls.BodyHash(response.Response)
+				require.NoError(t, file.SaveBody(responses[i].Hash, response.Response))
+			}
+			require.NoError(t, file.SaveResponse(0, responses[i]))
+		}
+		require.NoError(t, file.Close())
+		file, err = storage.OpenFile(binaryPath)
+		require.NoError(t, err)
+		defer file.Close()
+		state, err := file.Load()
+		require.NoError(t, err)
+		require.Len(t, state.Urls, 1)
+		assert.Equal(t, responses, state.Urls[0].Responses)
+	})
+
+	t.Run("OpenFile reads text bodies written by older versions", func(t *testing.T) {
+		oldPath := filepath.Join(dir, "old.log")
+		data := `{"op":"save_url","url_id":0,"url":{"url":"https://httpbin.org/range/15","interval":5}}` + "\n" +
+			`{"op":"response","url_id":0,"response":{"seq":1,"response":"abcd","duration":5,"created_at":"2017-07-14T02:40:00Z"}}` + "\n"
+		require.NoError(t, ioutil.WriteFile(oldPath, []byte(data), 0644))
+		file, err := storage.OpenFile(oldPath)
+		require.NoError(t, err)
+		defer file.Close()
+		state, err := file.Load()
+		require.NoError(t, err)
+		require.Len(t, state.Urls, 1)
+		expected := []api.UrlResponse{{Seq: 1, Response: []byte("abcd"), Hash: urls.BodyHash([]byte("abcd")), Duration: 5, CreatedAt: time.Unix(1500000000, 0).UTC()}}
+		assert.Equal(t, expected, state.Urls[0].Responses)
+	})
+
+	t.Run("OpenFile stores each body once", func(t *testing.T) {
+		dedupPath := filepath.Join(dir, "dedup.log")
+		data := `{"op":"save_url","url_id":0,"url":{"url":"https://httpbin.org/range/15","interval":5}}` + "\n" +
+			`{"op":"save_url","url_id":1,"url":{"url":"https://httpbin.org/range/15","interval":5}}` + "\n" +
+			`{"op":"response","url_id":0,"response":{"seq":1,"response":"abcd","created_at":"2017-07-14T02:40:00Z"}}` + "\n" +
+			`{"op":"response","url_id":1,"response":{"seq":1,"body":"YWJjZA==","created_at":"2017-07-14T02:40:00Z"}}` + "\n"
+		require.NoError(t, ioutil.WriteFile(dedupPath, []byte(data), 0644))
+		file, err := storage.OpenFile(dedupPath)
+		require.NoError(t, err)
+		hash := urls.BodyHash([]byte("abcd"))
+		require.NoError(t, file.SaveResponse(1, api.UrlResponse{Seq: 2, Response: []byte("abcd"), Hash: hash, CreatedAt: time.Unix(1500000001, 0).UTC()}))
+		require.NoError(t, file.Close())
+		file, err = storage.OpenFile(dedupPath)
+		require.NoError(t, err)
+		defer file.Close()
+		state, err := file.Load()
+		require.NoError(t, err)
+		require.Len(t, state.Urls, 2)
+		require.Len(t, state.Urls[0].Responses, 1)
+		require.Len(t, state.Urls[1].Responses, 2)
+		for _, response := range append(state.Urls[0].Responses, state.Urls[1].Responses...) {
+			assert.Equal(t, "abcd", string(response.Response))
+			assert.Equal(t, hash, response.Hash)
+		}
+		compacted, err := ioutil.ReadFile(dedupPath)
+		require.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(compacted), `"op":"body"`))
+		assert.Equal(t, 1, strings.Count(string(compacted), "YWJjZA=="))
+	})
+
+	t.Run("OpenFile restores updated responses", func(t *testing.T) {
+		updatePath := filepath.Join(dir, "update.log")
+		file, err := storage.OpenFile(updatePath)
+		require.NoError(t, err)
+		require.NoError(t, file.SaveUrl(0, api.NewUrl{Url: u, IntervalSeconds: 5}))
+		first := api.UrlResponse{Seq: 1, Response: []byte("abc"), Hash: urls.BodyHash([]byte("abc")), CreatedAt: time.Unix(1500000000, 0).UTC()}
+		second := api.UrlResponse{Seq: 2, Error: api.FetchErrorTimeout, CreatedAt: time.Unix(1500000001, 0).UTC()}
+		require.NoError(t, file.SaveBody(first.Hash, first.Response))
+		require.NoError(t, file.SaveResponse(0, first))
+		require.NoError(t, file.SaveResponse(0, second))
+		second.Unchanged = 2
+		second.LastSeenAt = time.Unix(1500000003, 0).UTC()
+		require.NoError(t, file.UpdateResponse(0, second))
+		require.NoError(t, file.UpdateResponse(0, api.UrlResponse{Seq: 7})) // evicted response is ignored
+		require.NoError(t, file.Close())
+		file, err = storage.OpenFile(updatePath)
+		require.NoError(t, err)
+		defer file.Close()
+		state, err := file.Load()
+		require.NoError(t, err)
+		require.Len(t, state.Urls, 1)
+		assert.Equal(t, []api.UrlResponse{first, second}, state.Urls[0].Responses)
+	})
+
+	t.Run("OpenFile restores paused state", func(t *testing.T) {
+		pausePath := filepath.Join(dir, "pause.log")
+		file, err := storage.OpenFile(pausePath)
+		require.NoError(t, err)
+		for id := uint64(0); id < 3; id++ {
+			require.NoError(t, file.SaveUrl(id, api.NewUrl{Url: u, IntervalSeconds: 5}))
+			require.NoError(t, file.SavePaused(id, true))
+		}
+		require.NoError(t, file.SavePaused(1, false))
+		require.NoError(t, file.SaveUrl(2, api.NewUrl{Url: u, IntervalSeconds: 6})) // paused state is kept
+		require.NoError(t, file.Close())
+		for i := 0; i < 2; i++ { // the second time from compacted file
+			file, err = storage.OpenFile(pausePath)
+			require.NoError(t, err)
+			state, err := file.Load()
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+			require.Len(t, state.Urls, 3)
+			assert.True(t, state.Urls[0].Paused)
+			assert.False(t, state.Urls[1].Paused)
+			assert.True(t, state.Urls[2].Paused)
+			assert.Equal(t, 6, state.Urls[2].Url.IntervalSeconds)
+		}
+	})
+
+	t.Run("log is compacted while file is open", func(t *testing.T) {
+		compactPath := filepath.Join(dir, "compact.log")
+		file, err := storage.OpenFile(compactPath, storage.WithCompactionInterval(10))
+		require.NoError(t, err)
+		require.NoError(t, file.SaveNextId(1))
+		require.NoError(t, file.SaveUrl(0, api.NewUrl{Url: u, IntervalSeconds: 5}))
+		var responses []api.UrlResponse
+		for i := 0; i < 100; i++ {
+			body := []byte(fmt.Sprint(i))
+			response := api.UrlResponse{Seq: uint64(i + 1), Response: body, Hash: urls.BodyHash(body), CreatedAt: time.Unix(1500000000+int64(i), 0).UTC()}
+			require.NoError(t, file.SaveBody(response.Hash, response.Response))
+			require.NoError(t, file.SaveResponse(0, response))
+			responses = append(responses, response)
+			if len(responses) > 2 {
+				require.NoError(t, file.EvictResponses(0, 1))
+				responses = responses[1:]
+			}
+		}
+		compacted, err := ioutil.ReadFile(compactPath)
+		require.NoError(t, err)
+		assert.Less(t, strings.Count(string(compacted), "\n"), 30, "log has 6 live records and 298 written ones")
+		require.NoError(t, file.Close())
+
+		file, err = storage.OpenFile(compactPath)
+		require.NoError(t, err)
+		defer file.Close()
+		state, err := file.Load()
+		require.NoError(t, err)
+		require.Len(t, state.Urls, 1)
+		assert.Equal(t, uint64(1), state.NextId)
+		assert.Equal(t, responses, state.Urls[0].Responses)
+	})
+
+	t.Run("log with live records is not compacted while file is open", func(t *testing.T) {
+		livePath := filepath.Join(dir, "live.log")
+		file, err := storage.OpenFile(livePath, storage.WithCompactionInterval(10))
+		require.NoError(t, err)
+		defer file.Close()
+		require.NoError(t, file.SaveUrl(0, api.NewUrl{Url: u, IntervalSeconds: 5}))
+		for i := 0; i < 50; i++ {
+			body := []byte(fmt.Sprint(i % 5))
+			response := api.UrlResponse{Seq: uint64(i + 1), Hash: urls.BodyHash(body), CreatedAt: time.Unix(1500000000+int64(i), 0).UTC()}
+			if i < 5 {
+				require.NoError(t, file.SaveBody(response.Hash, body))
+			}
+			require.NoError(t, file.SaveResponse(0, response))
+		}
+		written, err := ioutil.ReadFile(livePath)
+		require.NoError(t, err)
+		assert.Equal(t, 57, strings.Count(string(written), "\n"), "next id, url, 5 bodies and 50 responses")
+	})
+
+	t.Run("OpenFile returns error on response with unknown body", func(t *testing.T) {
+		unknownPath := filepath.Join(dir, "unknown.log")
+		data := `{"op":"save_url","url_id":0,"url":{"url":"https://httpbin.org/range/15","interval":5}}` + "\n" +
+			`{"op":"response","url_id":0,"response":{"seq":1,"hash":"abcd","body":null,"created_at":"2017-07-14T02:40:00Z"}}` + "\n"
+		require.NoError(t, ioutil.WriteFile(unknownPath, []byte(data), 0644))
+		_, err := storage.OpenFile(unknownPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("OpenFile returns error on corrupted file", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(path, []byte("xyz\n{}\n"), 0644))
+		_, err := storage.OpenFile(path)
+		assert.Error(t, err)
+	})
+}
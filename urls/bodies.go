@@ -0,0 +1,52 @@
+package urls
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"fetcher/api"
+)
+
+// bodyStore keeps single copy of each distinct response body, shared by all responses (of all urls) which have it.
+// Bodies are identified by their hash and removed when the last response referencing them is removed.
+type bodyStore map[string]*storedBody
+
+type storedBody struct {
+	body []byte
+	refs int
+}
+
+// BodyHash returns hash identifying body in api.UrlResponse
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// add sets hash of response and replaces its body with the stored copy. It returns true if body was not stored before.
+func (s bodyStore) add(response *api.UrlResponse) bool {
+	if response.Response == nil {
+		return false
+	}
+	if response.Hash == "" {
+		response.Hash = BodyHash(response.Response)
+	}
+	if stored, ok := s[response.Hash]; ok {
+		stored.refs++
+		response.Response = stored.body
+		return false
+	}
+	s[response.Hash] = &storedBody{body: response.Response, refs: 1}
+	return true
+}
+
+// release removes reference of response to its body
+func (s bodyStore) release(response api.UrlResponse) {
+	stored, ok := s[response.Hash]
+	if !ok {
+		return
+	}
+	stored.refs--
+	if stored.refs == 0 {
+		delete(s, response.Hash)
+	}
+}
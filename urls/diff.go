@@ -0,0 +1,58 @@
+package urls
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"fetcher/api"
+	"fetcher/diff"
+)
+
+// GetFetcherDiff compares bodies of two responses of url given by seq
+func (u *Urls) GetFetcherDiff(urlId uint64, fromSeq uint64, toSeq uint64) (api.ResponseDiff, error) {
+	from, err := u.GetFetcherResponse(urlId, fromSeq)
+	if err != nil {
+		return api.ResponseDiff{}, err
+	}
+	to, err := u.GetFetcherResponse(urlId, toSeq)
+	if err != nil {
+		return api.ResponseDiff{}, err
+	}
+	return diffResponses(from, to), nil
+}
+
+func diffResponses(from, to api.UrlResponse) api.ResponseDiff {
+	result := api.ResponseDiff{
+		From:  from.Seq,
+		To:    to.Seq,
+		Equal: bytes.Equal(from.Response, to.Response),
+	}
+	if !api.IsText(from.ContentType, from.Response) || !api.IsText(to.ContentType, to.Response) {
+		result.Binary = true
+		return result
+	}
+	result.Unified = diff.Unified(fmt.Sprintf("seq %d", from.Seq), fmt.Sprintf("seq %d", to.Seq), string(from.Response), string(to.Response))
+	fromJson, fromOk := decodeJsonBody(from.Response)
+	toJson, toOk := decodeJsonBody(to.Response)
+	if fromOk && toOk {
+		result.Json = []api.JsonChange{}
+		for _, change := range diff.Json(fromJson, toJson) {
+			result.Json = append(result.Json, api.JsonChange(change))
+		}
+	}
+	return result
+}
+
+// decodeJsonBody decodes body if it is json object or array
+func decodeJsonBody(body []byte) (interface{}, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, false
+	}
+	var value interface{}
+	if err := json.Unmarshal(trimmed, &value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
@@ -0,0 +1,131 @@
+package urls
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"fetcher/api"
+)
+
+// InsertResponse inserts response into responses ordered by CreatedAt and Seq.
+// Responses usually come in order, so it is cheap in practice.
+// Storage implementations should use it when replaying history, so that evictions remove the same responses as in Urls.
+func InsertResponse(responses []api.UrlResponse, response api.UrlResponse) []api.UrlResponse {
+	i := len(responses)
+	for i > 0 && response.CreatedAt.Before(responses[i-1].CreatedAt) {
+		i--
+	}
+	responses = append(responses, api.UrlResponse{})
+	copy(responses[i+1:], responses[i:])
+	responses[i] = response
+	return responses
+}
+
+// GetFetcherResponse returns response with given seq (it is not found if it was evicted)
+func (u *Urls) GetFetcherResponse(urlId uint64, seq uint64) (api.UrlResponse, error) {
+	u.urlMapMutex.RLock()
+	defer u.urlMapMutex.RUnlock()
+	urlData, ok := u.urlMap[urlId]
+	if !ok {
+		return api.UrlResponse{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	// responses are ordered by CreatedAt, which usually (but not always) agrees with Seq
+	for i := len(urlData.Responses) - 1; i >= 0; i-- {
+		if urlData.Responses[i].Seq == seq {
+			return copyResponse(urlData.Responses[i]), nil
+		}
+	}
+	return api.UrlResponse{}, fmt.Errorf(api.BackendErrorNotFound)
+}
+
+func (u *Urls) QueryFetcherHistory(urlId uint64, query api.HistoryQuery) (api.HistoryPage, error) {
+	u.urlMapMutex.RLock()
+	defer u.urlMapMutex.RUnlock()
+	urlData, ok := u.urlMap[urlId]
+	if !ok {
+		return api.HistoryPage{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	responses := urlData.Responses
+	begin, end := 0, len(responses)
+	if !query.From.IsZero() {
+		begin = sort.Search(len(responses), func(i int) bool {
+			return !responses[i].CreatedAt.Before(query.From)
+		})
+	}
+	if !query.To.IsZero() {
+		end = sort.Search(len(responses), func(i int) bool {
+			return !responses[i].CreatedAt.Before(query.To)
+		})
+	}
+	if query.After != nil {
+		if query.Order == api.HistoryOrderDesc {
+			// in descending order, next page ends just before the cursor
+			beforeCursor := sort.Search(len(responses), func(i int) bool {
+				return !isBeforeCursor(responses[i], *query.After)
+			})
+			if beforeCursor < end {
+				end = beforeCursor
+			}
+		} else {
+			afterCursor := sort.Search(len(responses), func(i int) bool {
+				return isAfterCursor(responses[i], *query.After)
+			})
+			if afterCursor > begin {
+				begin = afterCursor
+			}
+		}
+	}
+	page := api.HistoryPage{Responses: []api.UrlResponse{}}
+	if begin >= end {
+		return page, nil
+	}
+	count := end - begin
+	if query.Limit > 0 && query.Limit < count {
+		count = query.Limit
+	}
+	for i := 0; i < count; i++ {
+		index := begin + i
+		if query.Order == api.HistoryOrderDesc {
+			index = end - 1 - i
+		}
+		page.Responses = append(page.Responses, copyResponse(responses[index]))
+	}
+	if count < end-begin {
+		last := page.Responses[count-1]
+		page.NextCursor = &api.HistoryCursor{CreatedAt: last.CreatedAt, Seq: last.Seq}
+	}
+	return page, nil
+}
+
+func isAfterCursor(response api.UrlResponse, cursor api.HistoryCursor) bool {
+	if response.CreatedAt.Equal(cursor.CreatedAt) {
+		return response.Seq > cursor.Seq
+	}
+	return response.CreatedAt.After(cursor.CreatedAt)
+}
+
+func isBeforeCursor(response api.UrlResponse, cursor api.HistoryCursor) bool {
+	if response.CreatedAt.Equal(cursor.CreatedAt) {
+		return response.Seq < cursor.Seq
+	}
+	return response.CreatedAt.Before(cursor.CreatedAt)
+}
+
+// copyResponse returns deep copy of response, so that it can be returned without holding urlMapMutex
+func copyResponse(response api.UrlResponse) api.UrlResponse {
+	if response.Response != nil {
+		response.Response = append([]byte{}, response.Response...)
+	}
+	if response.Headers != nil {
+		headers := make(map[string]string, len(response.Headers))
+		for key, value := range response.Headers {
+			headers[key] = value
+		}
+		response.Headers = headers
+	}
+	if response.AttemptDurations != nil {
+		response.AttemptDurations = append([]time.Duration(nil), response.AttemptDurations...)
+	}
+	return response
+}
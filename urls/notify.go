@@ -0,0 +1,63 @@
+package urls
+
+import (
+	"fetcher/api"
+)
+
+// Notifier delivers notifications about changes of url state to webhooks of the url and possibly to other targets.
+// Notify is called with Urls locked, so it must not block (e.g. it should deliver notifications in background).
+type Notifier interface {
+	Notify(notification api.Notification, webhooks []api.Webhook)
+}
+
+// WithNotifier makes Urls report changes of url state to given notifier
+func WithNotifier(n Notifier) Option {
+	return func(u *Urls) {
+		u.notifier = n
+	}
+}
+
+// noNotifier is used when no notifier is configured
+type noNotifier struct{}
+
+func (noNotifier) Notify(notification api.Notification, webhooks []api.Webhook) {}
+
+// recordStatus updates status of url with response and notifies about changes of its state.
+// It must be called with urlMapMutex locked.
+func (u *Urls) recordStatus(urlId uint64, data *urlData, response api.UrlResponse) {
+	previous := data.status
+	data.status.record(response, data.Definition.Assertions)
+	for _, event := range stateEvents(previous, data.status) {
+		notification := api.Notification{
+			Event:      event,
+			UrlId:      urlId,
+			Url:        redactUrl(data.Definition.Url),
+			Seq:        response.Seq,
+			CreatedAt:  response.CreatedAt,
+			StatusCode: response.StatusCode,
+			Error:      response.Error,
+			Hash:       response.Hash,
+		}
+		if event == api.EventChanged {
+			notification.PreviousHash = previous.lastHash
+		}
+		u.notifier.Notify(notification, data.Definition.Webhooks)
+	}
+}
+
+// stateEvents returns events (api.Event* constants) caused by change of status from previous to current
+func stateEvents(previous, current fetcherStatus) []string {
+	if current.lastFetch.Equal(previous.lastFetch) {
+		return nil // response was skipped or came out of order
+	}
+	// transitions follow health, so that e.g. status accepted by status_codes assertion is not a failure
+	switch {
+	case current.health == api.HealthDown && previous.health != api.HealthDown:
+		return []string{api.EventDown}
+	case current.health != api.HealthDown && previous.health == api.HealthDown:
+		return []string{api.EventUp}
+	case current.lastOutcome == api.OutcomeSuccess && previous.lastHash != "" && current.lastHash != previous.lastHash:
+		return []string{api.EventChanged}
+	}
+	return nil
+}
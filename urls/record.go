@@ -0,0 +1,62 @@
+package urls
+
+import (
+	"log"
+
+	"fetcher/api"
+)
+
+// mergeUnchanged merges response into the newest response of url if record mode of url does not add it to history.
+// It returns false if response should be added. It must be called with urlMapMutex locked.
+func (u *Urls) mergeUnchanged(urlId uint64, data *urlData, response api.UrlResponse) bool {
+	if len(data.Responses) == 0 {
+		return false
+	}
+	newest := &data.Responses[len(data.Responses)-1]
+	if !isUnchanged(data.Definition.Record, *newest, response) {
+		return false
+	}
+	newest.Unchanged++
+	newest.LastSeenAt = response.CreatedAt
+	if err := u.storage.UpdateResponse(urlId, *newest); err != nil {
+		log.Printf("could not update response of url %d in storage: %s", urlId, err)
+	}
+	return true
+}
+
+// isUnchanged tells whether response has the same outcome (body, error, status code and results of assertions) as previous one and should not be added to history
+func isUnchanged(mode string, previous, response api.UrlResponse) bool {
+	switch mode {
+	case api.RecordOnChange:
+	case api.RecordOnChangeOrError:
+		if response.Response == nil {
+			return false
+		}
+	default:
+		return false
+	}
+	if previous.Skipped || response.Skipped {
+		return false // skipped ticks are not fetches
+	}
+	lastSeen := previous.CreatedAt
+	if !previous.LastSeenAt.IsZero() {
+		lastSeen = previous.LastSeenAt
+	}
+	if response.CreatedAt.Before(lastSeen) {
+		return false // response came out of order
+	}
+	return response.Hash == previous.Hash && response.Error == previous.Error && response.StatusCode == previous.StatusCode &&
+		sameAssertionResults(previous.Assertions, response.Assertions)
+}
+
+func sameAssertionResults(a, b []api.AssertionResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Passed != b[i].Passed {
+			return false
+		}
+	}
+	return true
+}
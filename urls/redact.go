@@ -0,0 +1,62 @@
+package urls
+
+import (
+	"net/url"
+	"strings"
+
+	"fetcher/api"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Parts of header names which suggest that header value is a secret
+var secretHeaderNameParts = []string{"auth", "cookie", "token", "secret", "key", "password", "session"}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		redacted[name] = value
+		lowerName := strings.ToLower(name)
+		for _, part := range secretHeaderNameParts {
+			if strings.Contains(lowerName, part) {
+				redacted[name] = redactedValue
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// redactUrl returns url as string with password (if any) redacted
+func redactUrl(u *url.URL) string {
+	return redactedUrl(u).String()
+}
+
+func redactedUrl(u *url.URL) *url.URL {
+	if u.User == nil {
+		return u
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return u
+	}
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx") // brackets from redactedValue would be escaped in url
+	return &redacted
+}
+
+func redactWebhooks(webhooks []api.Webhook) []api.Webhook {
+	if webhooks == nil {
+		return nil
+	}
+	redacted := make([]api.Webhook, len(webhooks))
+	for i, webhook := range webhooks {
+		redacted[i].Url = redactedUrl(webhook.Url)
+		if webhook.Secret != "" {
+			redacted[i].Secret = redactedValue
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,66 @@
+package urls
+
+import (
+	"log"
+	"time"
+
+	"fetcher/api"
+)
+
+// sweepRetention periodically evicts responses exceeding retention policies of all urls, so that max_age is enforced
+// also for urls which are not fetched (e.g. paused, one-shot or failing with stretched interval)
+func (u *Urls) sweepRetention() {
+	for {
+		timer, stopTimer := u.clock.Timer(u.clock.Now().Add(u.sweepInterval))
+		now := <-timer
+		stopTimer()
+		u.urlMapMutex.Lock()
+		for urlId, data := range u.urlMap {
+			u.evictOldResponses(urlId, data, now)
+		}
+		u.urlMapMutex.Unlock()
+	}
+}
+
+// evictOldResponses removes the oldest responses which exceed retention policy of given url.
+// The newest response is always kept, even if it exceeds byte limit by itself.
+// It must be called with urlMapMutex locked.
+func (u *Urls) evictOldResponses(urlId uint64, data *urlData, now time.Time) {
+	policy := u.retention.Merge(data.Definition.Retention)
+	if policy.IsUnlimited() {
+		return
+	}
+	evicted := 0
+	for evicted < len(data.Responses)-1 {
+		remaining := len(data.Responses) - evicted
+		oldest := data.Responses[evicted]
+		if (policy.MaxEntries == 0 || remaining <= policy.MaxEntries) &&
+			(policy.MaxAge == 0 || now.Sub(oldest.CreatedAt) <= policy.MaxAge) &&
+			(policy.MaxBytes == 0 || data.responsesBytes <= policy.MaxBytes) {
+			break
+		}
+		data.responsesBytes -= responseSize(oldest)
+		u.bodies.release(oldest)
+		data.Responses[evicted] = api.UrlResponse{} // let evicted response be garbage collected
+		evicted++
+	}
+	if evicted == 0 {
+		return
+	}
+	data.Responses = data.Responses[evicted:]
+	if err := u.storage.EvictResponses(urlId, evicted); err != nil {
+		log.Printf("could not evict responses of url %d from storage: %s", urlId, err)
+	}
+}
+
+func responseSize(response api.UrlResponse) int {
+	return len(response.Response)
+}
+
+func responsesSize(responses []api.UrlResponse) int {
+	size := 0
+	for _, response := range responses {
+		size += responseSize(response)
+	}
+	return size
+}
@@ -0,0 +1,70 @@
+package urls
+
+import (
+	"time"
+
+	"fetcher/api"
+)
+
+// fetcherStatus is updated with each response passed by worker to onFetch and each next run passed to onSchedule
+type fetcherStatus struct {
+	nextRun             time.Time     // reported by worker
+	interval            time.Duration // used for the next run, reported by worker
+	lastFetch           time.Time
+	lastOutcome         string
+	consecutiveFailures int
+	totalFetches        int
+	health              string
+	lastHash            string // hash of body of the last successful response
+}
+
+// record updates status with response of url with given assertions
+func (s *fetcherStatus) record(response api.UrlResponse, assertions []api.Assertion) {
+	if response.Skipped {
+		return // it is not a fetch
+	}
+	s.totalFetches++
+	// responses may come out of order (e.g. previous request timed out after the next one succeeded)
+	if response.CreatedAt.Before(s.lastFetch) {
+		return
+	}
+	s.lastFetch = response.CreatedAt
+	s.health = health(response, assertions)
+	if response.Response == nil {
+		s.lastOutcome = api.OutcomeFailure
+		s.consecutiveFailures++
+	} else {
+		s.lastOutcome = api.OutcomeSuccess
+		s.consecutiveFailures = 0
+		s.lastHash = response.Hash
+	}
+}
+
+// health returns one of api.Health* constants for response of url with given assertions
+func health(response api.UrlResponse, assertions []api.Assertion) string {
+	statusAsserted, failed := false, false
+	for i, result := range response.Assertions {
+		if !result.Passed {
+			failed = true
+		} else if i < len(assertions) && assertions[i].Kind() == api.AssertionStatusCodes {
+			statusAsserted = true
+		}
+	}
+	if response.Response == nil && !(response.Error == api.FetchErrorStatus && statusAsserted) {
+		return api.HealthDown
+	}
+	if failed {
+		return api.HealthDegraded
+	}
+	return api.HealthHealthy
+}
+
+func (s *fetcherStatus) toApi() api.UrlStatus {
+	return api.UrlStatus{
+		NextRun:             s.nextRun,
+		LastFetch:           s.lastFetch,
+		LastOutcome:         s.lastOutcome,
+		ConsecutiveFailures: s.consecutiveFailures,
+		TotalFetches:        s.totalFetches,
+	}
+}
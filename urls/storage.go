@@ -0,0 +1,74 @@
+package urls
+
+import (
+	"fetcher/api"
+)
+
+// Storage persists url definitions, id counter and fetch history so that they survive restarts.
+// Urls calls it while holding its own lock, so implementations do not have to care about ordering of calls.
+type Storage interface {
+	Load() (StoredState, error)
+	SaveNextId(nextId uint64) error
+	SaveUrl(urlId uint64, url api.NewUrl) error
+	DeleteUrl(urlId uint64) error
+	SavePaused(urlId uint64, paused bool) error // paused state is kept when url is saved again
+	// SaveBody is called before the first response with given body (identified by its hash) is saved. It is called
+	// again if body appears after all responses which had it were removed. Saved responses refer to body by its hash.
+	SaveBody(hash string, body []byte) error
+	SaveResponse(urlId uint64, response api.UrlResponse) error
+	// UpdateResponse replaces saved response with the same Seq
+	UpdateResponse(urlId uint64, response api.UrlResponse) error
+	EvictResponses(urlId uint64, count int) error // removes count oldest responses
+}
+
+// Returned by Storage.Load
+type StoredState struct {
+	NextId uint64
+	Urls   []StoredUrl
+}
+
+type StoredUrl struct {
+	Id        uint64
+	Url       api.NewUrl
+	Paused    bool
+	Responses []api.UrlResponse
+}
+
+// noStorage is used when no storage is configured - everything is kept only in memory
+type noStorage struct{}
+
+func (noStorage) Load() (StoredState, error) {
+	return StoredState{}, nil
+}
+
+func (noStorage) SaveNextId(nextId uint64) error {
+	return nil
+}
+
+func (noStorage) SaveUrl(urlId uint64, url api.NewUrl) error {
+	return nil
+}
+
+func (noStorage) DeleteUrl(urlId uint64) error {
+	return nil
+}
+
+func (noStorage) SavePaused(urlId uint64, paused bool) error {
+	return nil
+}
+
+func (noStorage) SaveBody(hash string, body []byte) error {
+	return nil
+}
+
+func (noStorage) SaveResponse(urlId uint64, response api.UrlResponse) error {
+	return nil
+}
+
+func (noStorage) UpdateResponse(urlId uint64, response api.UrlResponse) error {
+	return nil
+}
+
+func (noStorage) EvictResponses(urlId uint64, count int) error {
+	return nil
+}
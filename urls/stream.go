@@ -0,0 +1,162 @@
+package urls
+
+import (
+	"fmt"
+
+	"fetcher/api"
+)
+
+const (
+	// Capacity of channel of each subscriber - subscriber which falls behind by more events is disconnected
+	subscriberBuffer = 256
+	// Number of the most recent events kept to resume stream of all urls
+	recentEventsSize = 256
+)
+
+type subscriber struct {
+	urlId  *uint64 // nil if subscriber receives responses of all urls
+	events chan api.StreamEvent
+}
+
+// streams passes recorded responses to subscribers. It must be used with Urls.urlMapMutex locked.
+// Events share responses with history - recorded responses are not modified (and their bodies are shared anyway, see bodyStore).
+type streams struct {
+	subscribers map[*subscriber]struct{}
+	lastEventId uint64            // id of the newest event in stream of all urls
+	recent      []api.StreamEvent // the most recent events in stream of all urls, oldest first, without bodies (only with hashes)
+}
+
+func newStreams() streams {
+	return streams{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Subscribe returns subscription to responses of url (or of all urls), which receives events without blocking onFetch.
+// With LastEventId, it first receives responses from history (stream of single url) or recent events (stream of all urls)
+// which follow given event, or reset event if they are not available.
+func (u *Urls) Subscribe(query api.StreamQuery) (api.Subscription, error) {
+	u.urlMapMutex.Lock()
+	defer u.urlMapMutex.Unlock()
+	var backlog []api.StreamEvent
+	if query.UrlId != nil {
+		data, ok := u.urlMap[*query.UrlId]
+		if !ok {
+			return api.Subscription{}, fmt.Errorf(api.BackendErrorNotFound)
+		}
+		if query.LastEventId != nil {
+			backlog = urlBacklog(*query.UrlId, data, *query.LastEventId)
+		}
+	} else if query.LastEventId != nil {
+		backlog = u.streams.since(*query.LastEventId, u.bodies)
+	}
+	s := &subscriber{urlId: query.UrlId, events: make(chan api.StreamEvent, len(backlog)+subscriberBuffer)}
+	for _, event := range backlog {
+		s.events <- event
+	}
+	u.streams.subscribers[s] = struct{}{}
+	cancel := func() {
+		u.urlMapMutex.Lock()
+		defer u.urlMapMutex.Unlock()
+		u.streams.remove(s)
+	}
+	return api.Subscription{Events: s.events, Cancel: cancel}, nil
+}
+
+// urlBacklog returns responses of url which follow event with given id (seq of response). The newest response is returned
+// also when it is the given event, if record mode merged responses into it - client may have missed the update.
+// If responses which follow the event were evicted (or id is greater than seq of any response, e.g. from before
+// the history was lost), it returns only reset event.
+func urlBacklog(urlId uint64, data *urlData, lastEventId uint64) []api.StreamEvent {
+	reset := []api.StreamEvent{{Id: data.lastSeq, UrlId: urlId, Reset: true}}
+	if lastEventId > data.lastSeq {
+		return reset
+	}
+	var backlog []api.StreamEvent
+	oldestSeq := data.lastSeq + 1
+	for i, response := range data.Responses {
+		if response.Seq < oldestSeq {
+			oldestSeq = response.Seq
+		}
+		merged := i == len(data.Responses)-1 && response.Unchanged > 0
+		if response.Seq > lastEventId || (response.Seq == lastEventId && merged) {
+			backlog = append(backlog, api.StreamEvent{Id: response.Seq, UrlId: urlId, Response: response})
+		}
+	}
+	if lastEventId+1 < oldestSeq {
+		return reset
+	}
+	return backlog
+}
+
+// since returns recent events which follow event with given id in stream of all urls, with bodies taken from store.
+// If some of them (or their bodies) are not kept anymore (or id is from before restart), it returns only reset event.
+func (s *streams) since(lastEventId uint64, bodies bodyStore) []api.StreamEvent {
+	reset := []api.StreamEvent{{Id: s.lastEventId, Reset: true}}
+	if lastEventId > s.lastEventId {
+		return reset
+	}
+	if lastEventId == s.lastEventId {
+		return nil
+	}
+	if len(s.recent) == 0 || lastEventId+1 < s.recent[0].Id {
+		return reset
+	}
+	events := append([]api.StreamEvent(nil), s.recent[lastEventId+1-s.recent[0].Id:]...)
+	for i, event := range events {
+		if event.Response.Hash == "" {
+			continue
+		}
+		stored, ok := bodies[event.Response.Hash]
+		if !ok {
+			return reset // all responses with the body were removed
+		}
+		events[i].Response.Response = stored.body
+	}
+	return events
+}
+
+// publish passes response of url to its subscribers and subscribers of all urls
+func (s *streams) publish(urlId uint64, response api.UrlResponse) {
+	s.lastEventId++
+	event := api.StreamEvent{Id: s.lastEventId, UrlId: urlId, Response: response}
+	recentEvent := event
+	recentEvent.Response.Response = nil // body is kept by bodyStore as long as some response has it
+	s.recent = append(s.recent, recentEvent)
+	if len(s.recent) > recentEventsSize {
+		s.recent[0] = api.StreamEvent{}
+		s.recent = s.recent[1:]
+	}
+	for subscriber := range s.subscribers {
+		if subscriber.urlId == nil {
+			s.send(subscriber, event)
+		} else if *subscriber.urlId == urlId {
+			urlEvent := event
+			urlEvent.Id = response.Seq
+			s.send(subscriber, urlEvent)
+		}
+	}
+}
+
+// send disconnects subscriber whose channel is full instead of waiting for it
+func (s *streams) send(subscriber *subscriber, event api.StreamEvent) {
+	select {
+	case subscriber.events <- event:
+	default:
+		s.remove(subscriber)
+	}
+}
+
+// closeUrl disconnects subscribers of deleted url
+func (s *streams) closeUrl(urlId uint64) {
+	for subscriber := range s.subscribers {
+		if subscriber.urlId != nil && *subscriber.urlId == urlId {
+			s.remove(subscriber)
+		}
+	}
+}
+
+func (s *streams) remove(subscriber *subscriber) {
+	if _, ok := s.subscribers[subscriber]; ok {
+		delete(s.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
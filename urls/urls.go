@@ -2,39 +2,117 @@ package urls
 
 import (
 	"fmt"
-	"net/url"
+	"log"
 	"sort"
 	"sync"
+	"time"
 
 	"fetcher/api"
+	"fetcher/clock"
 )
 
+// Worker fetches url according to its interval or schedule until stopChan is written to. It passes each response
+// to onFetch and time of each next run to onSchedule (zero time if fetcher will not run anymore) with interval used for it.
+// Callbacks must not be called from NewFetchRoutine, because it is called with Urls locked.
 type Worker interface {
-	NewFetchRoutine(newUrl api.NewUrl, onFetch func(response api.UrlResponse), stopChan chan struct{})
+	NewFetchRoutine(newUrl api.NewUrl, onFetch func(response api.UrlResponse), onSchedule func(nextRun time.Time, interval time.Duration), stopChan chan struct{})
 }
 
-func New(w Worker) *Urls {
+type Option func(u *Urls)
+
+// WithStorage makes Urls persist all changes in given storage. Call LoadFromStorage to restore previous state.
+func WithStorage(s Storage) Option {
+	return func(u *Urls) {
+		u.storage = s
+	}
+}
+
+// WithClock sets source of current time, which should be the same as clock of worker
+func WithClock(clock clock.Clock) Option {
+	return func(u *Urls) {
+		u.clock = clock
+	}
+}
+
+// WithRetentionSweep sets interval of checking retention policies of all urls, which evicts responses exceeding
+// max_age also from urls which are not fetched (e.g. paused ones)
+func WithRetentionSweep(interval time.Duration) Option {
+	return func(u *Urls) {
+		u.sweepInterval = interval
+	}
+}
+
+// DefaultRetentionSweepInterval is interval of checking retention policies of all urls
+const DefaultRetentionSweepInterval = time.Minute
+
+// WithRetention sets global retention policy, which can be overridden for each url in NewUrl
+func WithRetention(policy api.RetentionPolicy) Option {
+	return func(u *Urls) {
+		u.retention = policy
+	}
+}
+
+func New(w Worker, options ...Option) *Urls {
 	u := &Urls{
-		worker: w,
-		urlMap: make(map[uint64]*urlData),
+		worker:        w,
+		storage:       noStorage{},
+		clock:         clock.Real{},
+		sweepInterval: DefaultRetentionSweepInterval,
+		notifier:      noNotifier{},
+		urlMap:        make(map[uint64]*urlData),
+		bodies:        make(bodyStore),
+		streams:       newStreams(),
 	}
+	for _, option := range options {
+		option(u)
+	}
+	go u.sweepRetention()
 	return u
 }
 
 type Urls struct {
-	worker      Worker
-	urlMap      map[uint64]*urlData
-	urlMapMutex sync.RWMutex
-	idManager   urlIdManager
+	worker        Worker
+	storage       Storage
+	clock         clock.Clock
+	notifier      Notifier
+	retention     api.RetentionPolicy
+	sweepInterval time.Duration
+	urlMap        map[uint64]*urlData
+	bodies        bodyStore // bodies of responses of all urls
+	streams       streams
+	urlMapMutex   sync.RWMutex
+	idManager     urlIdManager
 }
 
 type urlData struct {
-	Url                *url.URL
-	Interval           int
+	Definition         api.NewUrl
 	Responses          []api.UrlResponse
+	responsesBytes     int
+	lastSeq            uint64
+	status             fetcherStatus
+	paused             bool // fetcher is not running
 	stopFetcherChannel chan struct{}
 }
 
+func newUrlData(url api.NewUrl, responses []api.UrlResponse) *urlData {
+	if responses == nil {
+		responses = []api.UrlResponse{}
+	}
+	data := &urlData{
+		Definition:         url,
+		Responses:          responses,
+		responsesBytes:     responsesSize(responses),
+		stopFetcherChannel: make(chan struct{}, 1),
+	}
+	for _, response := range responses {
+		data.status.record(response, url.Assertions)
+		if response.Seq > data.lastSeq {
+			data.lastSeq = response.Seq
+		}
+	}
+	return data
+}
+
 type urlIdManager struct {
 	mutex sync.Mutex
 	maxId uint64
@@ -49,15 +127,46 @@ func (i *urlIdManager) NextId() uint64 {
 	return id
 }
 
+func (i *urlIdManager) SetNextId(nextId uint64) {
+	i.mutex.Lock()
+	if nextId > i.maxId {
+		i.maxId = nextId
+	}
+	i.mutex.Unlock()
+}
+
+// LoadFromStorage restores urls and their history from storage and restarts fetchers for them.
+// It should be called once, before Urls is used.
+func (u *Urls) LoadFromStorage() error {
+	state, err := u.storage.Load()
+	if err != nil {
+		return err
+	}
+	u.urlMapMutex.Lock()
+	defer u.urlMapMutex.Unlock()
+	u.idManager.SetNextId(state.NextId)
+	for _, storedUrl := range state.Urls {
+		u.idManager.SetNextId(storedUrl.Id + 1)
+		for i := range storedUrl.Responses {
+			u.bodies.add(&storedUrl.Responses[i])
+		}
+		restoredUrlData := newUrlData(storedUrl.Url, storedUrl.Responses)
+		restoredUrlData.paused = storedUrl.Paused
+		u.urlMap[storedUrl.Id] = restoredUrlData
+		// retention policy may have changed and responses may have expired since they were stored
+		u.evictOldResponses(storedUrl.Id, restoredUrlData, u.clock.Now())
+		if !storedUrl.Paused {
+			u.startFetcher(storedUrl.Id)
+		}
+	}
+	return nil
+}
+
 func (u *Urls) GetAllUrls() ([]api.ReturnedUrl, error) {
 	u.urlMapMutex.RLock()
 	returnedUrls := make([]api.ReturnedUrl, 0, len(u.urlMap))
 	for id, urlData := range u.urlMap {
-		returnedUrls = append(returnedUrls, api.ReturnedUrl{
-			Id:          id,
-			UrlAsString: urlData.Url.String(),
-			Interval:    urlData.Interval,
-		})
+		returnedUrls = append(returnedUrls, u.returnedUrl(id, urlData))
 	}
 	u.urlMapMutex.RUnlock()
 	sort.Slice(returnedUrls, func(i, j int) bool {
@@ -66,6 +175,66 @@ func (u *Urls) GetAllUrls() ([]api.ReturnedUrl, error) {
 	return returnedUrls, nil
 }
 
+func (u *Urls) GetUrl(urlId uint64) (api.UrlDetails, error) {
+	u.urlMapMutex.RLock()
+	defer u.urlMapMutex.RUnlock()
+	urlData, ok := u.urlMap[urlId]
+	if !ok {
+		return api.UrlDetails{}, fmt.Errorf(api.BackendErrorNotFound)
+	}
+	return api.UrlDetails{
+		ReturnedUrl: u.returnedUrl(urlId, urlData),
+		Status:      urlData.status.toApi(),
+	}, nil
+}
+
+// returnedUrl must be called with urlMapMutex locked
+func (u *Urls) returnedUrl(urlId uint64, data *urlData) api.ReturnedUrl {
+	returnedUrl := api.ReturnedUrl{
+		Id:          urlId,
+		UrlAsString: redactUrl(data.Definition.Url),
+		Interval:    data.Definition.IntervalSeconds,
+		Schedule:    data.Definition.Schedule,
+		Timeout:     data.Definition.Timeout.Seconds(),
+		Overlap:     data.Definition.Overlap,
+		Offset:      data.Definition.Offset.Seconds(),
+		Jitter:      data.Definition.Jitter.Seconds(),
+		Retry:       data.Definition.Retry,
+		Backoff:     data.Definition.Backoff,
+		MaxBodySize: data.Definition.MaxBodySize,
+		Record:      data.Definition.Record,
+		Assertions:  data.Definition.Assertions,
+		Health:      data.status.health,
+		Paused:      data.paused,
+		Webhooks:    redactWebhooks(data.Definition.Webhooks),
+		Method:      data.Definition.Method,
+		Headers:     redactHeaders(data.Definition.Headers),
+	}
+	if !data.status.nextRun.IsZero() {
+		returnedUrl.NextRun = data.status.nextRun.Unix()
+	}
+	if data.Definition.Backoff != nil {
+		configured := time.Duration(data.Definition.IntervalSeconds) * time.Second
+		effective := data.status.interval
+		if effective == 0 {
+			effective = configured // not reported by worker yet
+		}
+		returnedUrl.EffectiveInterval = effective.Seconds()
+		returnedUrl.Breaker = api.BreakerClosed
+		if effective > configured {
+			returnedUrl.Breaker = api.BreakerOpen
+		}
+	}
+	if data.Definition.Body != nil {
+		body := *data.Definition.Body
+		returnedUrl.Body = &body
+	}
+	if retention := u.retention.Merge(data.Definition.Retention); !retention.IsUnlimited() {
+		returnedUrl.Retention = &retention
+	}
+	return returnedUrl
+}
+
 func (u *Urls) GetFetcherHistory(urlId uint64) ([]api.UrlResponse, error) {
 	u.urlMapMutex.RLock()
 	urlData, ok := u.urlMap[urlId]
@@ -76,48 +245,171 @@ func (u *Urls) GetFetcherHistory(urlId uint64) ([]api.UrlResponse, error) {
 	returnedResponses := make([]api.UrlResponse, 0, len(urlData.Responses))
 	// deep-copy all responses to avoid races (urlData may be modified later)
 	for _, response := range urlData.Responses {
-		var responsePtr *string
-		if response.Response == nil {
-			responsePtr = nil
-		} else {
-			responseAsString := *response.Response
-			responsePtr = &responseAsString
-		}
-		returnedResponses = append(returnedResponses, api.UrlResponse{
-			Response:  responsePtr,
-			Duration:  response.Duration,
-			CreatedAt: response.CreatedAt,
-		})
+		returnedResponses = append(returnedResponses, copyResponse(response))
 	}
 	u.urlMapMutex.RUnlock()
-	sort.Slice(returnedResponses, func(i, j int) bool {
-		return returnedResponses[i].CreatedAt.Before(returnedResponses[j].CreatedAt)
-	})
 	return returnedResponses, nil
 }
 
 func (u *Urls) PostNewUrl(url api.NewUrl) (api.UrlId, error) {
+	if err := validateScheduleTime(url, u.clock.Now()); err != nil {
+		return api.UrlId{}, err
+	}
+	u.urlMapMutex.Lock()
+	defer u.urlMapMutex.Unlock()
+	// id is taken under urlMapMutex so that ids are saved in storage in increasing order
 	newId := u.idManager.NextId()
-	newUrlMapEntry := &urlData{
-		Url:                url.Url,
-		Interval:           url.IntervalSeconds,
-		Responses:          []api.UrlResponse{},
-		stopFetcherChannel: make(chan struct{}, 1),
+	if err := u.storage.SaveNextId(newId + 1); err != nil {
+		return api.UrlId{}, err
+	}
+	if err := u.storage.SaveUrl(newId, url); err != nil {
+		return api.UrlId{}, err
+	}
+	u.urlMap[newId] = newUrlData(url, nil)
+	u.startFetcher(newId)
+	return api.UrlId{Id: newId}, nil
+}
+
+// PatchUrl changes url definition and restarts its fetcher with new settings, keeping history
+func (u *Urls) PatchUrl(urlId uint64, patch api.UrlPatch) error {
+	u.urlMapMutex.Lock()
+	defer u.urlMapMutex.Unlock()
+	patchedUrlData, ok := u.urlMap[urlId]
+	if !ok {
+		return fmt.Errorf(api.BackendErrorNotFound)
+	}
+	definition := patch.Apply(patchedUrlData.Definition)
+	if err := definition.Validate(); err != nil {
+		return fmt.Errorf("%s: %s", api.BackendErrorBadRequest, err)
+	}
+	if err := validateScheduleTime(definition, u.clock.Now()); err != nil {
+		return err
+	}
+	if err := u.storage.SaveUrl(urlId, definition); err != nil {
+		return err
+	}
+	patchedUrlData.Definition = definition
+	if !patchedUrlData.paused {
+		u.stopFetcher(patchedUrlData)
+		u.startFetcher(urlId)
 	}
+	return nil
+}
+
+// PauseUrl stops fetcher of url, keeping its definition and history
+func (u *Urls) PauseUrl(urlId uint64) error {
+	u.urlMapMutex.Lock()
+	defer u.urlMapMutex.Unlock()
+	pausedUrlData, ok := u.urlMap[urlId]
+	if !ok {
+		return fmt.Errorf(api.BackendErrorNotFound)
+	}
+	if pausedUrlData.paused {
+		return nil
+	}
+	if err := u.storage.SavePaused(urlId, true); err != nil {
+		return err
+	}
+	u.stopFetcher(pausedUrlData)
+	pausedUrlData.paused = true
+	pausedUrlData.status.nextRun = time.Time{}
+	pausedUrlData.status.interval = 0
+	return nil
+}
+
+// ResumeUrl starts fetcher of paused url again
+func (u *Urls) ResumeUrl(urlId uint64) error {
 	u.urlMapMutex.Lock()
 	defer u.urlMapMutex.Unlock()
-	u.urlMap[newId] = newUrlMapEntry
+	resumedUrlData, ok := u.urlMap[urlId]
+	if !ok {
+		return fmt.Errorf(api.BackendErrorNotFound)
+	}
+	if !resumedUrlData.paused {
+		return nil
+	}
+	if err := validateScheduleTime(resumedUrlData.Definition, u.clock.Now()); err != nil {
+		return err
+	}
+	if err := u.storage.SavePaused(urlId, false); err != nil {
+		return err
+	}
+	resumedUrlData.paused = false
+	u.startFetcher(urlId)
+	return nil
+}
+
+// stopFetcher must be called with urlMapMutex locked. Responses of stopped fetcher which are still in progress are dropped.
+func (u *Urls) stopFetcher(data *urlData) {
+	data.stopFetcherChannel <- struct{}{}
+	data.stopFetcherChannel = make(chan struct{}, 1)
+}
+
+// validateScheduleTime rejects one-shot schedules which would never run.
+// It is not a part of NewUrl.Validate, because such urls are valid when they are restored from storage.
+func validateScheduleTime(url api.NewUrl, now time.Time) error {
+	if url.Schedule != nil && !url.Schedule.At.IsZero() && !url.Schedule.At.After(now) {
+		return fmt.Errorf("%s: schedule time %s is in the past", api.BackendErrorBadRequest, url.Schedule.At.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// startFetcher must be called with urlMapMutex locked
+func (u *Urls) startFetcher(urlId uint64) {
+	stopChan := u.urlMap[urlId].stopFetcherChannel
+	// currentEntry must be called with urlMapMutex locked
+	currentEntry := func() *urlData {
+		urlEntry, ok := u.urlMap[urlId]
+		// this may happen because stopFetcherChannel is buffered (DeleteUrl or PatchUrl may exit before worker goroutine ends)
+		if !ok || urlEntry.stopFetcherChannel != stopChan {
+			return nil
+		}
+		return urlEntry
+	}
 	onFetch := func(response api.UrlResponse) {
 		u.urlMapMutex.Lock()
 		defer u.urlMapMutex.Unlock()
-		urlEntry, ok := u.urlMap[newId]
-		if !ok {
-			return // this may happen because stopFetcherChannel is buffered (DeleteUrl may exit before worker goroutine ends)
+		urlEntry := currentEntry()
+		if urlEntry == nil {
+			return
+		}
+		if response.Response != nil {
+			response.Hash = BodyHash(response.Response)
+		}
+		if u.mergeUnchanged(urlId, urlEntry, response) {
+			response.Seq = urlEntry.lastSeq
+			u.recordStatus(urlId, urlEntry, response)
+			u.streams.publish(urlId, urlEntry.Responses[len(urlEntry.Responses)-1])
+			u.evictOldResponses(urlId, urlEntry, response.CreatedAt)
+			return
 		}
-		urlEntry.Responses = append(urlEntry.Responses, response)
+		urlEntry.lastSeq++
+		response.Seq = urlEntry.lastSeq
+		if u.bodies.add(&response) {
+			if err := u.storage.SaveBody(response.Hash, response.Response); err != nil {
+				log.Printf("could not save response body of url %d in storage: %s", urlId, err)
+			}
+		}
+		if err := u.storage.SaveResponse(urlId, response); err != nil {
+			log.Printf("could not save response of url %d in storage: %s", urlId, err)
+		}
+		u.recordStatus(urlId, urlEntry, response)
+		urlEntry.Responses = InsertResponse(urlEntry.Responses, response)
+		urlEntry.responsesBytes += responseSize(response)
+		u.streams.publish(urlId, response)
+		u.evictOldResponses(urlId, urlEntry, response.CreatedAt)
 	}
-	u.worker.NewFetchRoutine(url, onFetch, newUrlMapEntry.stopFetcherChannel) // this should run worker in new goroutine
-	return api.UrlId{Id: newId}, nil
+	onSchedule := func(nextRun time.Time, interval time.Duration) {
+		u.urlMapMutex.Lock()
+		defer u.urlMapMutex.Unlock()
+		if urlEntry := currentEntry(); urlEntry != nil {
+			urlEntry.status.nextRun = nextRun
+			urlEntry.status.interval = interval
+		}
+	}
+	u.urlMap[urlId].status.nextRun = time.Time{}
+	u.urlMap[urlId].status.interval = 0
+	u.worker.NewFetchRoutine(u.urlMap[urlId].Definition, onFetch, onSchedule, stopChan) // this should run worker in new goroutine
 }
 
 func (u *Urls) DeleteUrl(urlId uint64) error {
@@ -127,7 +419,14 @@ func (u *Urls) DeleteUrl(urlId uint64) error {
 	if !ok {
 		return fmt.Errorf(api.BackendErrorNotFound)
 	}
+	if err := u.storage.DeleteUrl(urlId); err != nil {
+		return err
+	}
 	deletedUrlData.stopFetcherChannel <- struct{}{}
+	for _, response := range deletedUrlData.Responses {
+		u.bodies.release(response)
+	}
 	delete(u.urlMap, urlId)
+	u.streams.closeUrl(urlId)
 	return nil
 }
@@ -0,0 +1,365 @@
+// Package websocket implements the subset of WebSocket protocol (RFC 6455) needed by api: upgrade of http request,
+// reading and writing of (possibly fragmented) text and binary messages, ping/pong and closing handshake.
+// Extensions and subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Message types
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+const (
+	opContinuation = 0
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+
+	closeNormal          = 1000
+	closeProtocolError   = 1002
+	closeInvalidData     = 1007
+	closeMessageTooLarge = 1009
+
+	// DefaultMaxMessageSize limits size of messages read from connection
+	DefaultMaxMessageSize = 1 << 20
+	// DefaultWriteTimeout limits time of writing each frame, so that the other side which does not read
+	// cannot block writers
+	DefaultWriteTimeout = 10 * time.Second
+
+	acceptGuid   = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	closeTimeout = time.Second
+)
+
+// ErrClosed is returned by ReadMessage when connection was closed by the other side (or by Close)
+var ErrClosed = errors.New("websocket: connection closed")
+
+// Conn is server or client side of WebSocket connection. Only one goroutine may read messages,
+// but messages can be written concurrently with reading and with each other. If write fails (e.g. because
+// WriteTimeout is exceeded), connection is closed, so that reading fails as well.
+type Conn struct {
+	MaxMessageSize int
+	WriteTimeout   time.Duration
+
+	conn       net.Conn
+	reader     *bufio.Reader
+	client     bool // frames written by client are masked, frames written by server are not
+	writeMutex sync.Mutex
+	closeSent  bool
+}
+
+// Upgrade switches http request to WebSocket connection. On failure, it writes error response and returns error.
+// Requests with Origin header are accepted only from pages served by the same host (see checkOrigin).
+func Upgrade(writer http.ResponseWriter, request *http.Request) (*Conn, error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if request.Method != http.MethodGet || !headerContains(request.Header, "Connection", "upgrade") ||
+		!headerContains(request.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(writer, "expected WebSocket handshake", http.StatusBadRequest)
+		return nil, fmt.Errorf("websocket: invalid handshake")
+	}
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(writer, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("websocket: unsupported version")
+	}
+	if !checkOrigin(request) {
+		http.Error(writer, "origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("websocket: origin %s not allowed", request.Header.Get("Origin"))
+	}
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		http.Error(writer, "WebSocket is not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: response writer does not support hijacking")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{MaxMessageSize: DefaultMaxMessageSize, WriteTimeout: DefaultWriteTimeout, conn: conn, reader: buffered.Reader}, nil
+}
+
+// checkOrigin allows requests without Origin header (which are not made by browsers) and requests from pages served
+// by the same host, so that pages of other sites cannot open connection with cookies of user (cross-site WebSocket hijacking)
+func checkOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, request.Host)
+}
+
+// Dial opens client connection to ws:// url
+func Dial(rawUrl string) (*Conn, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("websocket: unsupported scheme %s", u.Scheme)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	u.Scheme = "http"
+	request, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if err := request.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: handshake failed with status %d", response.StatusCode)
+	}
+	return &Conn{MaxMessageSize: DefaultMaxMessageSize, WriteTimeout: DefaultWriteTimeout, conn: conn, reader: reader, client: true}, nil
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGuid))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// headerContains tells whether comma-separated values of header contain given token (case-insensitive)
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message. Control frames are handled on the way - ping is answered
+// with pong and close frame is answered with close frame (then ErrClosed is returned).
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			_ = c.writeClose(closeNormal)
+			c.conn.Close()
+			return 0, nil, ErrClosed
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(closeProtocolError, "new message started before the previous one was finished")
+			}
+			messageType = opcode
+		case opContinuation:
+			if messageType == 0 {
+				return 0, nil, c.fail(closeProtocolError, "continuation frame without message")
+			}
+		default:
+			return 0, nil, c.fail(closeProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+		if len(message)+len(payload) > c.MaxMessageSize {
+			return 0, nil, c.fail(closeMessageTooLarge, "message is too large")
+		}
+		message = append(message, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(closeInvalidData, "text message is not valid utf-8")
+			}
+			if message == nil {
+				message = []byte{}
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(closeProtocolError, "reserved bits are set")
+	}
+	if masked == c.client {
+		return false, 0, nil, c.fail(closeProtocolError, "invalid masking of frame")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if opcode >= opClose && (!fin || length > 125) {
+		return false, 0, nil, c.fail(closeProtocolError, "invalid control frame")
+	}
+	if length > uint64(c.MaxMessageSize) {
+		return false, 0, nil, c.fail(closeMessageTooLarge, "message is too large")
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// fail closes connection because of protocol violation by the other side and returns error describing it
+func (c *Conn) fail(code int, reason string) error {
+	_ = c.writeClose(code)
+	c.conn.Close()
+	return fmt.Errorf("websocket: %s", reason)
+}
+
+// WriteMessage writes message (TextMessage or BinaryMessage) in single frame
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", messageType)
+	}
+	return c.writeFrame(messageType, data)
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|byte(opcode))
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[len(frame)-2:], uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(len(payload)))
+	}
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := start; i < len(frame); i++ {
+			frame[i] ^= mask[(i-start)%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	timeout := c.WriteTimeout
+	if opcode == opClose && timeout > closeTimeout {
+		timeout = closeTimeout // the other side may be gone already
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		c.conn.Close()
+		return err
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.conn.Close() // frame may be written partially
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) writeClose(code int) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return c.writeFrame(opClose, payload)
+}
+
+// Close sends close frame and closes connection without waiting for response of the other side.
+// Writing of close frame is cancelled after closeTimeout.
+func (c *Conn) Close() error {
+	_ = c.writeClose(closeNormal)
+	return c.conn.Close()
+}
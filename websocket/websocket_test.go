@@ -0,0 +1,219 @@
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/websocket"
+)
+
+// newEchoServer returns server which sends back each message it receives
+func newEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		conn, err := websocket.Upgrade(writer, request)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.MaxMessageSize = 100000
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func wsUrl(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// rawDial makes handshake and returns connection on which frames can be written directly
+func rawDial(t *testing.T, server *httptest.Server) (net.Conn, *bufio.Reader) {
+	conn, reader, response := handshake(t, server, "")
+	require.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", response.Header.Get("Sec-WebSocket-Accept")) // example from RFC 6455
+	return conn, reader
+}
+
+// handshake sends handshake request with given additional header lines (ending with \r\n) and returns response
+func handshake(t *testing.T, server *httptest.Server, header string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+header+"\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	return conn, reader, response
+}
+
+// maskedFrame returns frame as written by client
+func maskedFrame(fin bool, opcode byte, payload string) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{first, 0x80 | byte(len(payload))}, mask...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
+
+// readFrame reads unmasked frame written by server
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(reader, header[:])
+	require.NoError(t, err)
+	payload := make([]byte, header[1]&0x7f)
+	_, err = io.ReadFull(reader, payload)
+	require.NoError(t, err)
+	return header[0], payload
+}
+
+func TestWebSocket(t *testing.T) {
+	server := newEchoServer(t)
+	defer server.Close()
+
+	t.Run("messages are sent in both directions", func(t *testing.T) {
+		conn, err := websocket.Dial(wsUrl(server))
+		require.NoError(t, err)
+		defer conn.Close()
+		for _, message := range []string{"", "hello", strings.Repeat("a", 200), strings.Repeat("b", 70000)} {
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+			messageType, data, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, websocket.TextMessage, messageType)
+			assert.Equal(t, message, string(data))
+		}
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{0, 1, 2}))
+		messageType, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, websocket.BinaryMessage, messageType)
+		assert.Equal(t, []byte{0, 1, 2}, data)
+	})
+	t.Run("fragmented message is assembled and ping is answered between fragments", func(t *testing.T) {
+		conn, reader := rawDial(t, server)
+		defer conn.Close()
+		frames := append(maskedFrame(false, 1, "hel"), maskedFrame(true, 9, "p")...)
+		frames = append(frames, maskedFrame(true, 0, "lo")...)
+		_, err := conn.Write(frames)
+		require.NoError(t, err)
+		header, payload := readFrame(t, reader)
+		assert.Equal(t, byte(0x8a), header) // pong
+		assert.Equal(t, "p", string(payload))
+		header, payload = readFrame(t, reader)
+		assert.Equal(t, byte(0x81), header)
+		assert.Equal(t, "hello", string(payload))
+	})
+	t.Run("close frame is answered", func(t *testing.T) {
+		conn, reader := rawDial(t, server)
+		defer conn.Close()
+		_, err := conn.Write(maskedFrame(true, 8, "\x03\xe8"))
+		require.NoError(t, err)
+		header, payload := readFrame(t, reader)
+		assert.Equal(t, byte(0x88), header)
+		assert.Equal(t, []byte{0x03, 0xe8}, payload)
+	})
+	t.Run("unmasked frame from client closes connection with protocol error", func(t *testing.T) {
+		conn, reader := rawDial(t, server)
+		defer conn.Close()
+		_, err := conn.Write([]byte{0x81, 1, 'a'})
+		require.NoError(t, err)
+		header, payload := readFrame(t, reader)
+		assert.Equal(t, byte(0x88), header)
+		assert.Equal(t, uint16(1002), binary.BigEndian.Uint16(payload))
+	})
+	t.Run("too large message closes connection", func(t *testing.T) {
+		conn, err := websocket.Dial(wsUrl(server))
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, make([]byte, 100001)))
+		_, _, err = conn.ReadMessage()
+		assert.Equal(t, websocket.ErrClosed, err)
+	})
+	t.Run("invalid utf-8 in text message closes connection", func(t *testing.T) {
+		conn, reader := rawDial(t, server)
+		defer conn.Close()
+		_, err := conn.Write(maskedFrame(true, 1, "\xff"))
+		require.NoError(t, err)
+		header, payload := readFrame(t, reader)
+		assert.Equal(t, byte(0x88), header)
+		assert.Equal(t, uint16(1007), binary.BigEndian.Uint16(payload))
+	})
+	t.Run("Upgrade rejects request without handshake", func(t *testing.T) {
+		response, err := http.Get(server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+	t.Run("Upgrade accepts request from page of the same host", func(t *testing.T) {
+		conn, _, response := handshake(t, server, "Origin: https://TEST\r\n")
+		defer conn.Close()
+		assert.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	})
+	t.Run("Upgrade rejects request from page of other host", func(t *testing.T) {
+		for _, origin := range []string{"https://other", "https://test.other", "null"} {
+			conn, _, response := handshake(t, server, "Origin: "+origin+"\r\n")
+			conn.Close()
+			assert.Equal(t, http.StatusForbidden, response.StatusCode, origin)
+		}
+	})
+	t.Run("Dial fails on server which does not support WebSocket", func(t *testing.T) {
+		plain := httptest.NewServer(http.NotFoundHandler())
+		defer plain.Close()
+		_, err := websocket.Dial(wsUrl(plain))
+		assert.Error(t, err)
+	})
+	t.Run("WriteMessage fails after Close", func(t *testing.T) {
+		conn, err := websocket.Dial(wsUrl(server))
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+		require.Error(t, conn.WriteMessage(websocket.TextMessage, []byte("a")))
+	})
+	t.Run("write to client which does not read times out and closes connection", func(t *testing.T) {
+		errs := make(chan error, 2)
+		blocked := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			conn, err := websocket.Upgrade(writer, request)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.WriteTimeout = 50 * time.Millisecond
+			data := make([]byte, 1<<16)
+			for err == nil {
+				err = conn.WriteMessage(websocket.BinaryMessage, data)
+			}
+			errs <- err
+			_, _, err = conn.ReadMessage()
+			errs <- err
+		}))
+		defer blocked.Close()
+		conn, _ := rawDial(t, blocked)
+		defer conn.Close()
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-errs:
+				assert.Error(t, err)
+			case <-time.After(10 * time.Second):
+				require.Fail(t, "write is blocked")
+			}
+		}
+	})
+}
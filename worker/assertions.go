@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"fetcher/api"
+	"fetcher/jsonpath"
+)
+
+// assertion is api.Assertion with compiled regular expression and json path
+type assertion struct {
+	api.Assertion
+	regex *regexp.Regexp
+	path  jsonpath.Path
+}
+
+func compileAssertions(assertions []api.Assertion) ([]assertion, error) {
+	compiled := make([]assertion, 0, len(assertions))
+	for _, a := range assertions {
+		c := assertion{Assertion: a}
+		var err error
+		if a.BodyRegex != "" {
+			if c.regex, err = regexp.Compile(a.BodyRegex); err != nil {
+				return nil, err
+			}
+		}
+		if a.JsonPath != "" {
+			if c.path, err = jsonpath.Parse(a.JsonPath); err != nil {
+				return nil, err
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// evaluateAssertions returns results of assertions for response, nil if there are no assertions
+func evaluateAssertions(assertions []assertion, response api.UrlResponse) []api.AssertionResult {
+	if len(assertions) == 0 {
+		return nil
+	}
+	results := make([]api.AssertionResult, 0, len(assertions))
+	var document interface{}
+	documentErr := fmt.Errorf("no body")
+	if response.Response != nil {
+		documentErr = json.Unmarshal(response.Response, &document) // decoded once for all json_path assertions
+	}
+	for _, a := range assertions {
+		message := a.check(response, document, documentErr)
+		results = append(results, api.AssertionResult{Passed: message == "", Message: message})
+	}
+	return results
+}
+
+// check returns why response does not pass assertion, empty if it passes
+func (a *assertion) check(response api.UrlResponse, document interface{}, documentErr error) string {
+	switch a.Kind() {
+	case api.AssertionStatusCodes:
+		for _, code := range a.StatusCodes {
+			if response.StatusCode == code {
+				return ""
+			}
+		}
+		if response.StatusCode == 0 {
+			return fmt.Sprintf("no http response (%s)", response.Error)
+		}
+		return fmt.Sprintf("status code %d is not one of %v", response.StatusCode, a.StatusCodes)
+	case api.AssertionMaxLatency:
+		if response.Duration > a.MaxLatency {
+			return fmt.Sprintf("request took %s, more than %s", response.Duration, a.MaxLatency)
+		}
+		return ""
+	case api.AssertionHeader:
+		if _, ok := response.Headers[a.Header]; !ok {
+			return fmt.Sprintf("header %s is missing", a.Header)
+		}
+		return ""
+	}
+	if response.Response == nil {
+		return "no body"
+	}
+	switch a.Kind() {
+	case api.AssertionBodyContains:
+		if !bytes.Contains(response.Response, []byte(a.BodyContains)) {
+			return fmt.Sprintf("body does not contain %q", a.BodyContains)
+		}
+	case api.AssertionBodyRegex:
+		if !a.regex.Match(response.Response) {
+			return fmt.Sprintf("body does not match %q", a.BodyRegex)
+		}
+	case api.AssertionJsonPath:
+		if documentErr != nil {
+			return fmt.Sprintf("body is not valid json: %s", documentErr)
+		}
+		value, ok := a.path.Get(document)
+		if !ok {
+			return fmt.Sprintf("no value at %s", a.JsonPath)
+		}
+		if !reflect.DeepEqual(value, a.JsonEquals) {
+			actual, _ := json.Marshal(value)
+			expected, _ := json.Marshal(a.JsonEquals)
+			return fmt.Sprintf("value at %s is %s, expected %s", a.JsonPath, actual, expected)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+)
+
+func TestEvaluateAssertions(t *testing.T) {
+	assertions, err := compileAssertions([]api.Assertion{
+		{StatusCodes: []int{200, 204}},
+		{MaxLatency: time.Second},
+		{BodyContains: `"up"`},
+		{BodyRegex: `"version":\s*"2\.\d+"`},
+		{JsonPath: "$.checks[0].ok", JsonEquals: true},
+		{Header: "Etag"},
+	})
+	require.NoError(t, err)
+	passed := func(results []api.AssertionResult) []bool {
+		passed := make([]bool, 0, len(results))
+		for _, result := range results {
+			passed = append(passed, result.Passed)
+			assert.Equal(t, result.Passed, result.Message == "", "failed assertion should have message")
+		}
+		return passed
+	}
+
+	t.Run("response passing all assertions", func(t *testing.T) {
+		response := api.UrlResponse{
+			Response:   []byte(`{"status": "up", "version": "2.1", "checks": [{"ok": true}]}`),
+			StatusCode: 200,
+			Duration:   time.Second,
+			Headers:    map[string]string{"Etag": "abc"},
+		}
+		assert.Equal(t, []bool{true, true, true, true, true, true}, passed(evaluateAssertions(assertions, response)))
+	})
+	t.Run("response failing assertions", func(t *testing.T) {
+		response := api.UrlResponse{
+			Response:   []byte(`{"status": "down", "version": "1.9", "checks": [{"ok": false}]}`),
+			StatusCode: 204,
+			Duration:   time.Second + 1,
+		}
+		results := evaluateAssertions(assertions, response)
+		assert.Equal(t, []bool{true, false, false, false, false, false}, passed(results))
+		assert.Equal(t, "value at $.checks[0].ok is false, expected true", results[4].Message)
+		assert.Equal(t, "header Etag is missing", results[5].Message)
+	})
+	t.Run("failed response fails checks of body", func(t *testing.T) {
+		response := api.UrlResponse{Error: api.FetchErrorTimeout, Duration: 5 * time.Second}
+		results := evaluateAssertions(assertions, response)
+		assert.Equal(t, []bool{false, false, false, false, false, false}, passed(results))
+		assert.Equal(t, "no http response (timeout)", results[0].Message)
+		assert.Equal(t, "no body", results[2].Message)
+	})
+	t.Run("json path assertion on body which is not json", func(t *testing.T) {
+		results := evaluateAssertions(assertions, api.UrlResponse{Response: []byte("up"), StatusCode: 200})
+		assert.False(t, results[4].Passed)
+		assert.Contains(t, results[4].Message, "body is not valid json")
+	})
+	t.Run("without assertions results are nil", func(t *testing.T) {
+		assert.Nil(t, evaluateAssertions(nil, api.UrlResponse{Response: []byte("up")}))
+	})
+}
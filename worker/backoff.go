@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"time"
+
+	"fetcher/api"
+)
+
+// applyBackoff stretches interval of fetcher with backoff policy after its failure and restores it after success.
+// The next tick is counted from the fetch whose outcome changed the interval. It must be called with Worker.mutex locked.
+func (w *Worker) applyBackoff(f *fetcher, response api.UrlResponse) {
+	if f.url.Backoff == nil {
+		return
+	}
+	if response.Error == "" {
+		f.failures = 0
+	} else {
+		f.failures++
+	}
+	interval := f.url.Backoff.Interval(time.Duration(f.url.IntervalSeconds)*time.Second, f.failures)
+	if interval == f.interval {
+		return
+	}
+	f.interval = interval
+	f.anchor = response.CreatedAt
+	w.reschedule(f, w.clock.Now())
+	w.wakeUpScheduler()
+}
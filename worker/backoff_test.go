@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/clock"
+)
+
+func TestBackoff(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	transport := &statusSequence{statuses: []int{503, 503, 503, 200}}
+	w := New(WithClock(clock), WithTransport(transport))
+	u, err := url.Parse("http://fetcher.test/dead")
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	var nextRun time.Time
+	var interval time.Duration
+	responses := make(chan api.UrlResponse, 10)
+	newUrl := api.NewUrl{Url: u, IntervalSeconds: 10, Backoff: &api.BackoffPolicy{MaxInterval: 30 * time.Second}}
+	w.NewFetchRoutine(newUrl, func(response api.UrlResponse) {
+		responses <- response
+	}, func(reportedNextRun time.Time, reportedInterval time.Duration) {
+		mutex.Lock()
+		nextRun, interval = reportedNextRun, reportedInterval
+		mutex.Unlock()
+	}, make(chan struct{}, 1))
+
+	// each step moves clock to the next run and checks schedule after the response
+	for _, step := range []struct {
+		at               time.Duration
+		status           int
+		nextRun          time.Duration
+		intervalAfterRun time.Duration
+	}{
+		{at: 10 * time.Second, status: 503, nextRun: 30 * time.Second, intervalAfterRun: 20 * time.Second},
+		{at: 30 * time.Second, status: 503, nextRun: 60 * time.Second, intervalAfterRun: 30 * time.Second},
+		{at: 60 * time.Second, status: 503, nextRun: 90 * time.Second, intervalAfterRun: 30 * time.Second}, // limited
+		{at: 90 * time.Second, status: 200, nextRun: 100 * time.Second, intervalAfterRun: 10 * time.Second},
+	} {
+		clock.Advance(start.Add(step.at).Sub(clock.Now()))
+		select {
+		case response := <-responses:
+			assert.Equal(t, step.status, response.StatusCode)
+			assert.Equal(t, start.Add(step.at), response.CreatedAt)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timeout while waiting for response", "at %s", step.at)
+		}
+		require.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return nextRun.Equal(start.Add(step.nextRun)) && interval == step.intervalAfterRun
+		}, 5*time.Second, time.Millisecond, "at %s", step.at)
+	}
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"fetcher/clock"
+)
+
+// clockDeadlineContext is cancelled when deadline measured by Clock is exceeded
+type clockDeadlineContext struct {
+	context.Context
+	exceeded int32
+}
+
+func (c *clockDeadlineContext) Err() error {
+	if atomic.LoadInt32(&c.exceeded) == 1 {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// withClockDeadline works like context.WithDeadline, but deadline is measured by clock
+func withClockDeadline(parent context.Context, clock clock.Clock, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	deadlineCtx := &clockDeadlineContext{Context: ctx}
+	timer, stopTimer := clock.Timer(deadline)
+	go func() {
+		select {
+		case <-timer:
+			atomic.StoreInt32(&deadlineCtx.exceeded, 1)
+			cancel()
+		case <-ctx.Done():
+		}
+		stopTimer()
+	}()
+	return deadlineCtx, cancel
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+
+	"fetcher/api"
+)
+
+// classifyError returns category of error returned by http.Client.Do
+func classifyError(err error) api.FetchError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return api.FetchErrorTimeout
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return api.FetchErrorTimeout
+	}
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return api.FetchErrorDns
+	}
+	if isTlsError(err) {
+		return api.FetchErrorTls
+	}
+	var opError *net.OpError
+	if errors.As(err, &opError) && opError.Op == "dial" {
+		return api.FetchErrorConnect
+	}
+	return api.FetchErrorOther
+}
+
+func isTlsError(err error) bool {
+	var recordHeaderError tls.RecordHeaderError
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var certificateInvalidError x509.CertificateInvalidError
+	return errors.As(err, &recordHeaderError) ||
+		errors.As(err, &unknownAuthorityError) ||
+		errors.As(err, &hostnameError) ||
+		errors.As(err, &certificateInvalidError)
+}
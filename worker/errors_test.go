@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/clock"
+)
+
+func TestMakeHttpRequestErrors(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/ok", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain")
+		writer.Header().Set("X-Not-Recorded", "x")
+		_, _ = writer.Write([]byte("abcde"))
+	})
+	handler.HandleFunc("/chunked", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("abc"))
+		writer.(http.Flusher).Flush() // response is sent without Content-Length
+		_, _ = writer.Write([]byte("de"))
+	})
+	handler.HandleFunc("/created", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusCreated)
+		_, _ = writer.Write([]byte("abcde"))
+	})
+	handler.HandleFunc("/no-content", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	handler.HandleFunc("/not-found", func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	})
+	handler.HandleFunc("/slow", func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-request.Context().Done():
+		}
+	})
+	handler.HandleFunc("/broken-body", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Length", "100")
+		_, _ = writer.Write([]byte("abcde"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedPortUrl := "http://" + listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	fetch := func(rawUrl string) api.UrlResponse {
+		u, err := url.Parse(rawUrl)
+		require.NoError(t, err)
+		response, err := makeHttpRequest(api.NewUrl{Url: u, IntervalSeconds: 1}, DefaultTimeout, DefaultMaxBodySize, clock.Real{}, http.DefaultClient)
+		require.NoError(t, err)
+		return response
+	}
+
+	t.Run("successful response has status code and selected headers", func(t *testing.T) {
+		response := fetch(server.URL + "/ok")
+		require.NotNil(t, response.Response)
+		assert.Equal(t, "abcde", string(response.Response))
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "text/plain", response.Headers["Content-Type"])
+		assert.NotContains(t, response.Headers, "X-Not-Recorded")
+		assert.Equal(t, api.FetchError(""), response.Error)
+		assert.Equal(t, int64(5), response.Size)
+		assert.False(t, response.Truncated)
+	})
+	t.Run("headers checked by assertions are recorded", func(t *testing.T) {
+		u, err := url.Parse(server.URL + "/ok")
+		require.NoError(t, err)
+		newUrl := api.NewUrl{Url: u, IntervalSeconds: 1, Assertions: []api.Assertion{{Header: "X-Not-Recorded"}}}
+		response, err := makeHttpRequest(newUrl, DefaultTimeout, DefaultMaxBodySize, clock.Real{}, http.DefaultClient)
+		require.NoError(t, err)
+		assert.Contains(t, response.Headers, "X-Not-Recorded")
+	})
+	t.Run("body over size limit is truncated", func(t *testing.T) {
+		for _, path := range []string{"/ok", "/chunked"} {
+			u, err := url.Parse(server.URL + path)
+			require.NoError(t, err)
+			response, err := makeHttpRequest(api.NewUrl{Url: u, IntervalSeconds: 1}, DefaultTimeout, 3, clock.Real{}, http.DefaultClient)
+			require.NoError(t, err)
+			require.NotNil(t, response.Response, path)
+			assert.Equal(t, "abc", string(response.Response), path)
+			assert.True(t, response.Truncated, path)
+			if path == "/ok" {
+				assert.Equal(t, int64(5), response.Size, "size is taken from Content-Length")
+			} else {
+				assert.Equal(t, int64(4), response.Size, "size is number of bytes read")
+			}
+		}
+	})
+	t.Run("body of exactly size limit is not truncated", func(t *testing.T) {
+		u, err := url.Parse(server.URL + "/chunked")
+		require.NoError(t, err)
+		response, err := makeHttpRequest(api.NewUrl{Url: u, IntervalSeconds: 1}, DefaultTimeout, 5, clock.Real{}, http.DefaultClient)
+		require.NoError(t, err)
+		require.NotNil(t, response.Response)
+		assert.Equal(t, "abcde", string(response.Response))
+		assert.False(t, response.Truncated)
+		assert.Equal(t, int64(5), response.Size)
+	})
+	t.Run("any 2xx status is success", func(t *testing.T) {
+		response := fetch(server.URL + "/created")
+		require.NotNil(t, response.Response)
+		assert.Equal(t, "abcde", string(response.Response))
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+		assert.Equal(t, api.FetchError(""), response.Error)
+		response = fetch(server.URL + "/no-content")
+		assert.Equal(t, []byte{}, response.Response)
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+		assert.Equal(t, api.FetchError(""), response.Error)
+	})
+	t.Run("non-2xx status is reported as status error", func(t *testing.T) {
+		response := fetch(server.URL + "/not-found")
+		assert.Nil(t, response.Response)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		assert.Equal(t, api.FetchErrorStatus, response.Error)
+	})
+	t.Run("incomplete body is reported as body_read error", func(t *testing.T) {
+		response := fetch(server.URL + "/broken-body")
+		assert.Nil(t, response.Response)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, api.FetchErrorBodyRead, response.Error)
+	})
+	t.Run("refused connection is reported as connect error", func(t *testing.T) {
+		response := fetch(closedPortUrl)
+		assert.Equal(t, 0, response.StatusCode)
+		assert.Equal(t, api.FetchErrorConnect, response.Error)
+	})
+	t.Run("unknown host is reported as dns error", func(t *testing.T) {
+		response := fetch("http://nonexisting-url.invalid")
+		assert.Equal(t, api.FetchErrorDns, response.Error)
+	})
+	t.Run("untrusted certificate is reported as tls error", func(t *testing.T) {
+		response := fetch(tlsServer.URL + "/ok")
+		assert.Equal(t, api.FetchErrorTls, response.Error)
+	})
+	t.Run("exceeded timeout is reported as timeout error", func(t *testing.T) {
+		u, err := url.Parse(server.URL + "/slow")
+		require.NoError(t, err)
+		response, err := makeHttpRequest(api.NewUrl{Url: u, IntervalSeconds: 1}, 100*time.Millisecond, DefaultMaxBodySize, clock.Real{}, http.DefaultClient)
+		require.NoError(t, err)
+		assert.Equal(t, api.FetchErrorTimeout, response.Error)
+		assert.Equal(t, 100*time.Millisecond, response.Timeout)
+		assert.Less(t, int64(response.Duration), int64(time.Second))
+	})
+	t.Run("timeout is measured by clock of worker", func(t *testing.T) {
+		clock := clock.NewFake(time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC))
+		u, err := url.Parse(server.URL + "/slow")
+		require.NoError(t, err)
+		transport := startedTransport{started: make(chan struct{})}
+		done := make(chan api.UrlResponse)
+		go func() {
+			response, err := makeHttpRequest(api.NewUrl{Url: u, IntervalSeconds: 60}, time.Minute, DefaultMaxBodySize, clock, &http.Client{Transport: transport})
+			assert.NoError(t, err)
+			done <- response
+		}()
+		select {
+		case <-transport.started: // deadline timer is set before request starts
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "request was not started")
+		}
+		clock.Advance(time.Minute)
+		response := <-done
+		assert.Equal(t, api.FetchErrorTimeout, response.Error)
+		assert.Equal(t, time.Minute, response.Duration)
+	})
+	t.Run("deadline is reported as timeout error", func(t *testing.T) {
+		assert.Equal(t, api.FetchErrorTimeout, classifyError(&url.Error{Op: "Get", URL: server.URL, Err: timeoutError{}}))
+	})
+}
+
+// startedTransport signals that request has started and holds it until its context is done
+type startedTransport struct {
+	started chan struct{}
+}
+
+func (s startedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	close(s.started)
+	<-request.Context().Done()
+	return nil, request.Context().Err()
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"log"
+)
+
+// execute runs in each executor goroutine, making requests waiting in Worker.ready
+func (w *Worker) execute() {
+	w.mutex.Lock()
+	for {
+		r := w.takeReadyRequest()
+		if r == nil {
+			w.readyCond.Wait()
+			continue
+		}
+		f := r.fetcher
+		if r.attempt == 0 {
+			f.waiting = false
+		} else {
+			f.retrying--
+		}
+		if w.isStopped(f) {
+			continue
+		}
+		f.running++
+		w.hostRunning[f.host]++
+		w.busy++
+		w.mutex.Unlock()
+
+		response, retried, err := w.makeAttempt(r)
+
+		w.mutex.Lock()
+		f.running--
+		w.hostRunning[f.host]--
+		if w.hostRunning[f.host] == 0 {
+			delete(w.hostRunning, f.host)
+		}
+		w.busy--
+		if w.isStopped(f) {
+			continue
+		}
+		if retried {
+			w.scheduleRetry(r)
+			continue
+		}
+		if f.queued && !f.busy() {
+			f.queued = false
+			w.enqueue(f)
+		}
+		if err == nil {
+			w.applyBackoff(f, response)
+		}
+		w.mutex.Unlock()
+		if err != nil {
+			log.Println(err)
+		} else {
+			f.onFetch(response)
+		}
+		w.mutex.Lock()
+	}
+}
+
+// takeReadyRequest returns the first waiting request whose host is below concurrency limit, or nil.
+// It must be called with Worker.mutex locked.
+func (w *Worker) takeReadyRequest() *request {
+	for i, r := range w.ready {
+		if w.maxPerHost > 0 && w.hostRunning[r.fetcher.host] >= w.maxPerHost {
+			continue
+		}
+		copy(w.ready[i:], w.ready[i+1:])
+		w.ready[len(w.ready)-1] = nil
+		w.ready = w.ready[:len(w.ready)-1]
+		return r
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package worker_test
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/clock"
+	"fetcher/worker"
+)
+
+// blockingTransport answers requests with "abcde". Requests to host slow.test and to paths under /slow/ are held
+// until they are released, so that tests control how long they run. Concurrent requests are counted per host and url,
+// and in total under empty key.
+type blockingTransport struct {
+	mutex      sync.Mutex
+	running    map[string]int
+	maxRunning map[string]int
+	releases   map[string]chan struct{}
+}
+
+func newBlockingTransport() *blockingTransport {
+	return &blockingTransport{
+		running:    make(map[string]int),
+		maxRunning: make(map[string]int),
+		releases:   make(map[string]chan struct{}),
+	}
+}
+
+func (b *blockingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	rawUrl := request.URL.String()
+	keys := []string{"", request.URL.Host, rawUrl}
+	b.mutex.Lock()
+	for _, key := range keys {
+		b.running[key]++
+		if b.running[key] > b.maxRunning[key] {
+			b.maxRunning[key] = b.running[key]
+		}
+	}
+	release := b.release(rawUrl)
+	b.mutex.Unlock()
+	defer func() {
+		b.mutex.Lock()
+		for _, key := range keys {
+			b.running[key]--
+		}
+		b.mutex.Unlock()
+	}()
+	if request.URL.Host == "slow.test" || strings.HasPrefix(request.URL.Path, "/slow/") {
+		select {
+		case <-release:
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+	return fakeResponse(request, http.StatusOK, "abcde"), nil
+}
+
+// release must be called with blockingTransport.mutex locked
+func (b *blockingTransport) release(rawUrl string) chan struct{} {
+	release, ok := b.releases[rawUrl]
+	if !ok {
+		release = make(chan struct{})
+		b.releases[rawUrl] = release
+	}
+	return release
+}
+
+// Release lets one running request of url finish
+func (b *blockingTransport) Release(t *testing.T, rawUrl string) {
+	b.mutex.Lock()
+	release := b.release(rawUrl)
+	b.mutex.Unlock()
+	select {
+	case release <- struct{}{}:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no request to release", rawUrl)
+	}
+}
+
+// Running returns number of running requests of host or url (or all of them for empty key)
+func (b *blockingTransport) Running(key string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.running[key]
+}
+
+// MaxRunning returns the highest number of concurrent requests of host or url
+func (b *blockingTransport) MaxRunning(key string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.maxRunning[key]
+}
+
+func TestWorkerPool(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	transport := newBlockingTransport()
+	w := worker.New(worker.WithClock(clock), worker.WithTransport(transport), worker.WithExecutors(3), worker.WithMaxPerHost(2))
+
+	var mutex sync.Mutex
+	responses := make(map[string][]api.UrlResponse)
+	// fetched returns number of requests of url which were made (not skipped)
+	fetched := func(rawUrl string) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		count := 0
+		for _, r := range responses[rawUrl] {
+			if !r.Skipped {
+				count++
+			}
+		}
+		return count
+	}
+	var slowUrls []string
+	for i := 0; i < 4; i++ {
+		slowUrls = append(slowUrls, "http://slow.test/"+string(rune('a'+i)))
+	}
+	fastUrls := []string{"http://fast.test/a", "http://fast.test/b"}
+	for _, rawUrl := range append(append([]string{}, slowUrls...), fastUrls...) {
+		rawUrl := rawUrl
+		u, err := url.Parse(rawUrl)
+		require.NoError(t, err)
+		w.NewFetchRoutine(api.NewUrl{Url: u, IntervalSeconds: 1}, func(response api.UrlResponse) {
+			mutex.Lock()
+			responses[rawUrl] = append(responses[rawUrl], response)
+			mutex.Unlock()
+		}, func(nextRun time.Time, interval time.Duration) {}, make(chan struct{}, 1))
+	}
+	// running returns slow urls whose requests are in progress
+	running := func() []string {
+		var running []string
+		for _, rawUrl := range slowUrls {
+			if transport.Running(rawUrl) > 0 {
+				running = append(running, rawUrl)
+			}
+		}
+		return running
+	}
+
+	clock.Advance(time.Second)
+	waitFor(t, func() bool {
+		return fetched(fastUrls[0]) == 1 && fetched(fastUrls[1]) == 1 && transport.Running("slow.test") == 2 &&
+			w.GetWorkerStats().QueueDepth == 2
+	})
+	stats := w.GetWorkerStats()
+	assert.Equal(t, 3, stats.Executors)
+	assert.Equal(t, 6, stats.Fetchers)
+	assert.Equal(t, 2, stats.Busy, "only 2 requests to slow host may run concurrently")
+	assert.InDelta(t, 2.0/3.0, stats.Saturation, 0.001)
+	assert.Equal(t, 2, stats.QueueDepth, "2 other fetchers of slow host wait for executor")
+	firstRunning := running()
+	require.Len(t, firstRunning, 2)
+
+	t.Run("fetchers of slow host do not starve fetchers of other hosts", func(t *testing.T) {
+		clock.Advance(time.Second)
+		waitFor(t, func() bool {
+			return fetched(fastUrls[0]) == 2 && fetched(fastUrls[1]) == 2
+		})
+		assert.Equal(t, 2, transport.Running("slow.test"))
+	})
+	t.Run("waiting requests of the same host are served in turn", func(t *testing.T) {
+		for _, rawUrl := range firstRunning {
+			transport.Release(t, rawUrl)
+		}
+		// requests waiting since the first tick run before the ones added by the second tick
+		var waiting []string
+		for _, rawUrl := range slowUrls {
+			if rawUrl != firstRunning[0] && rawUrl != firstRunning[1] {
+				waiting = append(waiting, rawUrl)
+			}
+		}
+		waitFor(t, func() bool {
+			return reflect.DeepEqual(waiting, running())
+		})
+		for _, rawUrl := range running() {
+			transport.Release(t, rawUrl)
+		}
+		waitFor(t, func() bool {
+			for _, rawUrl := range slowUrls {
+				if fetched(rawUrl) != 1 {
+					return false
+				}
+			}
+			return true
+		})
+	})
+	t.Run("number of concurrent requests is limited globally and per host", func(t *testing.T) {
+		assert.Equal(t, 2, transport.MaxRunning("slow.test"))
+		for _, rawUrl := range slowUrls {
+			assert.Equal(t, 1, transport.MaxRunning(rawUrl))
+		}
+		assert.LessOrEqual(t, transport.MaxRunning(""), 3)
+	})
+}
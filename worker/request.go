@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fetcher/api"
+	"fetcher/clock"
+)
+
+// Response headers stored in history
+var recordedHeaders = []string{
+	"Cache-Control",
+	"Content-Encoding",
+	"Content-Length",
+	"Content-Type",
+	"Date",
+	"Etag",
+	"Last-Modified",
+	"Location",
+	"Retry-After",
+	"Server",
+}
+
+// makeHttpRequest makes single request of url. Response body is read up to maxBodySize bytes.
+func makeHttpRequest(url api.NewUrl, timeout time.Duration, maxBodySize int64, clock clock.Clock, client *http.Client) (api.UrlResponse, error) {
+	createdAt := clock.Now()
+	ctx, cancel := withClockDeadline(context.Background(), clock, createdAt.Add(timeout))
+	defer cancel()
+	request, err := newHttpRequest(ctx, url, createdAt)
+	if err != nil {
+		e := fmt.Errorf("could not create request for url %s: %s", url.Url.String(), err)
+		return api.UrlResponse{}, e
+	}
+	t1 := clock.Now()
+	response, err := client.Do(request)
+	t2 := clock.Now()
+	duration := t2.Sub(t1)
+	if err != nil {
+		fetchError := classifyError(err)
+		if ctx.Err() == context.DeadlineExceeded {
+			fetchError = api.FetchErrorTimeout // client may report only that request was cancelled
+		}
+		return api.UrlResponse{Duration: duration, CreatedAt: createdAt, Timeout: timeout, Error: fetchError}, nil
+	}
+	defer response.Body.Close()
+	urlResponse := api.UrlResponse{
+		Duration:    duration,
+		CreatedAt:   createdAt,
+		StatusCode:  response.StatusCode,
+		ContentType: response.Header.Get("Content-Type"),
+		Headers:     selectHeaders(response.Header, url.Assertions),
+		Timeout:     timeout,
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		urlResponse.Error = api.FetchErrorStatus
+		return urlResponse, nil
+	}
+	bytes, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBodySize+1)) // one more byte tells that body is too long
+	if err != nil {
+		urlResponse.Error = api.FetchErrorBodyRead
+		return urlResponse, nil
+	}
+	urlResponse.Size = int64(len(bytes))
+	if response.ContentLength > urlResponse.Size {
+		urlResponse.Size = response.ContentLength
+	}
+	if int64(len(bytes)) > maxBodySize {
+		bytes = bytes[:maxBodySize]
+		urlResponse.Truncated = true
+	}
+	urlResponse.Response = bytes
+	return urlResponse, nil
+}
+
+// selectHeaders returns recorded headers and headers checked by assertions
+func selectHeaders(header http.Header, assertions []api.Assertion) map[string]string {
+	selected := make(map[string]string)
+	for _, key := range recordedHeaders {
+		if values, ok := header[key]; ok {
+			selected[key] = strings.Join(values, ", ")
+		}
+	}
+	for _, assertion := range assertions {
+		if values, ok := header[assertion.Header]; ok {
+			selected[assertion.Header] = strings.Join(values, ", ")
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	return selected
+}
+
+// newHttpRequest builds request from url definition. Placeholders in query string, header values and body
+// are replaced with values for given time (see expandTemplate).
+func newHttpRequest(ctx context.Context, url api.NewUrl, now time.Time) (*http.Request, error) {
+	method := url.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	requestUrl := *url.Url
+	requestUrl.RawQuery = expandTemplate(requestUrl.RawQuery, now)
+	var body io.Reader
+	if url.Body != nil {
+		body = strings.NewReader(expandTemplate(*url.Body, now))
+	}
+	request, err := http.NewRequestWithContext(ctx, method, requestUrl.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range url.Headers {
+		value = expandTemplate(value, now)
+		if name == "Host" {
+			request.Host = value // Go ignores Host in request.Header
+		} else {
+			request.Header.Set(name, value)
+		}
+	}
+	return request, nil
+}
+
+// expandTemplate replaces placeholders:
+// {{unix}} - unix time in seconds, {{unix_ms}} - unix time in milliseconds,
+// {{rfc3339}} - time in RFC 3339 format, {{date}} - date in format YYYY-MM-DD (all in UTC)
+func expandTemplate(s string, now time.Time) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	now = now.UTC()
+	replacer := strings.NewReplacer(
+		"{{unix}}", strconv.FormatInt(now.Unix(), 10),
+		"{{unix_ms}}", strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10),
+		"{{rfc3339}}", now.Format(time.RFC3339),
+		"{{date}}", now.Format("2006-01-02"),
+	)
+	return replacer.Replace(s)
+}
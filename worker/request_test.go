@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+)
+
+func TestNewHttpRequest(t *testing.T) {
+	now := time.Date(2020, 8, 24, 5, 31, 9, 0, time.UTC)
+
+	t.Run("without method uses GET", func(t *testing.T) {
+		u, err := url.Parse("https://httpbin.org/range/15")
+		require.NoError(t, err)
+		request, err := newHttpRequest(context.Background(), api.NewUrl{Url: u, IntervalSeconds: 1}, now)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodGet, request.Method)
+		assert.Equal(t, "https://httpbin.org/range/15", request.URL.String())
+		assert.Nil(t, request.Body)
+	})
+
+	t.Run("with method, headers and body", func(t *testing.T) {
+		u, err := url.Parse("https://httpbin.org/post?since={{unix}}&day={{date}}")
+		require.NoError(t, err)
+		body := `{"at":"{{rfc3339}}"}`
+		newUrl := api.NewUrl{
+			Url:             u,
+			IntervalSeconds: 1,
+			Method:          http.MethodPost,
+			Headers:         map[string]string{"Authorization": "Bearer abc", "X-Request-Time": "{{unix_ms}}", "Host": "example.com"},
+			Body:            &body,
+		}
+		request, err := newHttpRequest(context.Background(), newUrl, now)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodPost, request.Method)
+		assert.Equal(t, "https://httpbin.org/post?since=1598247069&day=2020-08-24", request.URL.String())
+		assert.Equal(t, "Bearer abc", request.Header.Get("Authorization"))
+		assert.Equal(t, "1598247069000", request.Header.Get("X-Request-Time"))
+		assert.Equal(t, "example.com", request.Host)
+		requestBody, err := ioutil.ReadAll(request.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"at":"2020-08-24T05:31:09Z"}`, string(requestBody))
+	})
+}
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"container/heap"
+	"time"
+
+	"fetcher/api"
+)
+
+// request is a request of fetcher, which is made again according to retry policy of its url. Between attempts
+// it waits in Worker.retries and does not occupy executor.
+type request struct {
+	fetcher   *fetcher
+	attempt   int             // number of attempts made so far
+	createdAt time.Time       // time of the first attempt
+	durations []time.Duration // durations of attempts made so far
+	retryAt   time.Time       // when the next attempt is due
+	heapIndex int             // index in Worker.retries
+}
+
+// makeAttempt makes the next attempt of request. It returns true if request should be retried at request.retryAt,
+// otherwise the returned response is final.
+func (w *Worker) makeAttempt(r *request) (api.UrlResponse, bool, error) {
+	f := r.fetcher
+	policy := f.url.Retry
+	response, err := makeHttpRequest(f.url, f.timeout, f.maxBodySize, w.clock, w.client)
+	if err != nil {
+		return response, false, err
+	}
+	r.attempt++
+	if r.attempt == 1 {
+		r.createdAt = response.CreatedAt
+	}
+	r.durations = append(r.durations, response.Duration)
+	if policy != nil && r.attempt < policy.MaxAttempts && isRetried(policy, response) {
+		r.retryAt = w.clock.Now().Add(retryDelay(policy, r.attempt))
+		return response, true, nil
+	}
+	response.CreatedAt = r.createdAt
+	response.Attempts = r.attempt
+	if r.attempt > 1 {
+		response.AttemptDurations = r.durations
+	}
+	response.Assertions = evaluateAssertions(f.assertions, response)
+	return response, false, nil
+}
+
+// scheduleRetry passes request to scheduler, which enqueues it again at its retry time. Fetcher is busy
+// (e.g. for overlap policy) until the last attempt is finished. It must be called with Worker.mutex locked.
+func (w *Worker) scheduleRetry(r *request) {
+	r.fetcher.retrying++
+	heap.Push(&w.retries, r)
+	w.wakeUpScheduler()
+}
+
+func isRetried(policy *api.RetryPolicy, response api.UrlResponse) bool {
+	if response.Error == "" {
+		return false
+	}
+	if response.Error == api.FetchErrorStatus {
+		statusCodes := policy.StatusCodes
+		if statusCodes == nil {
+			statusCodes = api.DefaultRetryStatusCodes
+		}
+		for _, statusCode := range statusCodes {
+			if response.StatusCode == statusCode {
+				return true
+			}
+		}
+		return false
+	}
+	fetchErrors := policy.Errors
+	if fetchErrors == nil {
+		fetchErrors = api.DefaultRetryErrors
+	}
+	for _, fetchError := range fetchErrors {
+		if response.Error == fetchError {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay returns delay before given retry (counted from 1)
+func retryDelay(policy *api.RetryPolicy, retry int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < retry; i++ {
+		if (policy.MaxDelay != 0 && delay >= policy.MaxDelay) || delay > time.Duration(1<<62) {
+			break
+		}
+		delay *= 2
+	}
+	if policy.MaxDelay != 0 && delay > policy.MaxDelay {
+		return policy.MaxDelay
+	}
+	return delay
+}
+
+// requestHeap implements heap.Interface, request with the earliest retry is on top
+type requestHeap []*request
+
+func (h requestHeap) Len() int {
+	return len(h)
+}
+
+func (h requestHeap) Less(i, j int) bool {
+	return h[i].retryAt.Before(h[j].retryAt)
+}
+
+func (h requestHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *requestHeap) Push(x interface{}) {
+	r := x.(*request)
+	r.heapIndex = len(*h)
+	*h = append(*h, r)
+}
+
+func (h *requestHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	old[len(old)-1] = nil
+	r.heapIndex = -1
+	*h = old[:len(old)-1]
+	return r
+}
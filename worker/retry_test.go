@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/clock"
+)
+
+// statusSequence responds with given status codes, the last one is repeated
+type statusSequence struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests int
+}
+
+func (s *statusSequence) RoundTrip(request *http.Request) (*http.Response, error) {
+	s.mutex.Lock()
+	status := s.statuses[len(s.statuses)-1]
+	if s.requests < len(s.statuses) {
+		status = s.statuses[s.requests]
+	}
+	s.requests++
+	s.mutex.Unlock()
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("abcde")),
+		Request:    request,
+	}, nil
+}
+
+func (s *statusSequence) Requests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests
+}
+
+func TestRetries(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	u, err := url.Parse("http://fetcher.test/retry")
+	require.NoError(t, err)
+
+	// fetch starts worker with single executor and fetcher whose first tick is a minute after start,
+	// returned channel receives its responses
+	fetch := func(clock *clock.Fake, transport http.RoundTripper, newUrl api.NewUrl, stopChan chan struct{}) (*Worker, chan api.UrlResponse) {
+		w := New(WithClock(clock), WithTransport(transport), WithExecutors(1))
+		newUrl.Url = u
+		newUrl.IntervalSeconds = 60
+		newUrl.Timeout = 10 * time.Minute // so that timers of requests are not mistaken for retries
+		responses := make(chan api.UrlResponse, 10)
+		w.NewFetchRoutine(newUrl, func(response api.UrlResponse) {
+			responses <- response
+		}, func(nextRun time.Time, interval time.Duration) {}, stopChan)
+		clock.Advance(time.Minute)
+		return w, responses
+	}
+	waitForTimer := func(t *testing.T, clock *clock.Fake, deadline time.Time) {
+		require.Eventually(t, func() bool { return clock.HasTimer(deadline) }, 5*time.Second, time.Millisecond)
+	}
+
+	t.Run("failed requests are retried with exponential backoff limited by max delay", func(t *testing.T) {
+		clock := clock.NewFake(start)
+		transport := &statusSequence{statuses: []int{503, 502, 500, 200}}
+		policy := &api.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+		w, responses := fetch(clock, transport, api.NewUrl{Retry: policy}, make(chan struct{}, 1))
+		for _, delay := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+			waitForTimer(t, clock, clock.Now().Add(delay))
+			stats := w.GetWorkerStats()
+			assert.Equal(t, 0, stats.Busy, "executor is released while retry waits")
+			assert.Equal(t, 0, stats.QueueDepth)
+			clock.Advance(delay)
+		}
+		response := <-responses
+		assert.Equal(t, 4, transport.Requests())
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, api.FetchError(""), response.Error)
+		assert.Equal(t, 4, response.Attempts)
+		assert.Equal(t, []time.Duration{0, 0, 0, 0}, response.AttemptDurations)
+		assert.Equal(t, start.Add(time.Minute), response.CreatedAt)
+	})
+	t.Run("the last failure is recorded when attempts are exhausted", func(t *testing.T) {
+		clock := clock.NewFake(start)
+		transport := &statusSequence{statuses: []int{503}}
+		policy := &api.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second}
+		_, responses := fetch(clock, transport, api.NewUrl{Retry: policy}, make(chan struct{}, 1))
+		waitForTimer(t, clock, start.Add(time.Minute+time.Second))
+		clock.Advance(time.Second)
+		response := <-responses
+		assert.Equal(t, 2, transport.Requests())
+		assert.Equal(t, api.FetchErrorStatus, response.Error)
+		assert.Equal(t, 2, response.Attempts)
+	})
+	t.Run("errors which are not retryable are recorded immediately", func(t *testing.T) {
+		for _, c := range []struct {
+			policy *api.RetryPolicy
+			status int
+		}{
+			{policy: nil, status: 503},
+			{policy: &api.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second}, status: 404},
+			{policy: &api.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, StatusCodes: []int{}}, status: 503},
+		} {
+			transport := &statusSequence{statuses: []int{c.status, 200}}
+			_, responses := fetch(clock.NewFake(start), transport, api.NewUrl{Retry: c.policy}, make(chan struct{}, 1))
+			response := <-responses
+			assert.Equal(t, 1, transport.Requests())
+			assert.Equal(t, c.status, response.StatusCode)
+			assert.Equal(t, 1, response.Attempts)
+			assert.Nil(t, response.AttemptDurations)
+		}
+	})
+	t.Run("request waiting for retry is in progress for overlap policy", func(t *testing.T) {
+		clock := clock.NewFake(start)
+		transport := &statusSequence{statuses: []int{503, 200}}
+		policy := &api.RetryPolicy{MaxAttempts: 2, BaseDelay: 90 * time.Second}
+		_, responses := fetch(clock, transport, api.NewUrl{Retry: policy, Overlap: api.OverlapSkip}, make(chan struct{}, 1))
+		waitForTimer(t, clock, start.Add(2*time.Minute))
+		clock.Advance(time.Minute)
+		skipped := <-responses
+		assert.True(t, skipped.Skipped)
+		assert.Equal(t, start.Add(2*time.Minute), skipped.CreatedAt)
+		waitForTimer(t, clock, start.Add(150*time.Second))
+		clock.Advance(30 * time.Second)
+		response := <-responses
+		assert.Equal(t, 2, transport.Requests())
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, 2, response.Attempts)
+		assert.Equal(t, start.Add(time.Minute), response.CreatedAt)
+	})
+	t.Run("retries are abandoned when fetcher is stopped", func(t *testing.T) {
+		clock := clock.NewFake(start)
+		transport := &statusSequence{statuses: []int{503}}
+		stopChan := make(chan struct{}, 1)
+		policy := &api.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second}
+		w, responses := fetch(clock, transport, api.NewUrl{Retry: policy}, stopChan)
+		waitForTimer(t, clock, start.Add(time.Minute+time.Second))
+		stopChan <- struct{}{}
+		waitForTimer(t, clock, start.Add(time.Minute+time.Hour)) // scheduler has nothing to wait for
+		assert.Equal(t, 0, w.GetWorkerStats().Fetchers)
+		clock.Advance(time.Second)
+		assert.Equal(t, 1, transport.Requests())
+		assert.Empty(t, responses)
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := &api.RetryPolicy{MaxAttempts: 100, BaseDelay: 500 * time.Millisecond}
+	assert.Equal(t, 500*time.Millisecond, retryDelay(policy, 1))
+	assert.Equal(t, time.Second, retryDelay(policy, 2))
+	assert.Equal(t, 4*time.Second, retryDelay(policy, 4))
+	assert.Greater(t, int64(retryDelay(policy, 99)), int64(0))
+	policy.MaxDelay = 3 * time.Second
+	assert.Equal(t, 3*time.Second, retryDelay(policy, 4))
+	assert.Equal(t, 3*time.Second, retryDelay(policy, 99))
+}
@@ -0,0 +1,296 @@
+package worker
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+
+	"fetcher/api"
+	"fetcher/cron"
+)
+
+type fetcher struct {
+	url         api.NewUrl
+	timeout     time.Duration
+	maxBodySize int64
+	assertions  []assertion
+	interval    time.Duration                   // zero if url has schedule
+	anchor      time.Time                       // with interval, ticks are at anchor + k * interval for any integer k
+	schedule    func(after time.Time) time.Time // with schedule, returns the first tick after given time, zero if there is none
+	jitter      time.Duration
+	spread      bool // anchor is chosen by spreadGroup
+	host        string
+	onFetch     func(response api.UrlResponse)
+	onSchedule  func(nextRun time.Time, interval time.Duration)
+	stopChan    chan struct{}
+	stopped     bool
+	removed     chan struct{} // closed when fetcher is stopped
+	nextTick    time.Time     // without jitter
+	nextRun     time.Time     // nextTick with jitter, zero if fetcher will not run anymore
+	unreported  bool          // fetcher is in Worker.unreported
+	heapIndex   int
+	waiting     bool // request is waiting in Worker.ready for free executor
+	running     int  // number of requests in progress
+	retrying    int  // number of requests waiting for retry
+	queued      bool // request will be made when the running one finishes (api.OverlapQueue)
+	failures    int  // consecutive failures, counted only if url has backoff policy
+}
+
+func (f *fetcher) busy() bool {
+	return f.running > 0 || f.retrying > 0 || f.waiting
+}
+
+// tickAfter returns the first tick (without jitter) after given time, zero if there is none
+func (f *fetcher) tickAfter(after time.Time) time.Time {
+	if f.schedule != nil {
+		return f.schedule(after)
+	}
+	sinceAnchor := after.Sub(f.anchor)
+	ticks := sinceAnchor / f.interval
+	if sinceAnchor < 0 && sinceAnchor%f.interval != 0 {
+		ticks-- // round down
+	}
+	return f.anchor.Add((ticks + 1) * f.interval)
+}
+
+// scheduleFunc returns function computing ticks of url with schedule
+func scheduleFunc(schedule *api.Schedule) (func(after time.Time) time.Time, error) {
+	if !schedule.At.IsZero() {
+		at := schedule.At
+		return func(after time.Time) time.Time {
+			if at.After(after) {
+				return at
+			}
+			return time.Time{}
+		}, nil
+	}
+	expression, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil, err
+	}
+	location, err := schedule.Location()
+	if err != nil {
+		return nil, err
+	}
+	return func(after time.Time) time.Time {
+		return expression.Next(after.In(location))
+	}, nil
+}
+
+// reschedule sets next tick of fetcher to the first one after given time. It must be called with Worker.mutex locked.
+func (w *Worker) reschedule(f *fetcher, after time.Time) {
+	f.nextTick = f.tickAfter(after)
+	f.nextRun = f.nextTick
+	if !f.nextTick.IsZero() && f.jitter > 0 {
+		f.nextRun = f.nextTick.Add(time.Duration(w.random.Int63n(int64(f.jitter))))
+	}
+	if !f.unreported {
+		f.unreported = true
+		w.unreported = append(w.unreported, f)
+	}
+	if f.nextRun.IsZero() {
+		if f.heapIndex >= 0 {
+			heap.Remove(&w.fetchers, f.heapIndex)
+		}
+	} else if f.heapIndex >= 0 {
+		heap.Fix(&w.fetchers, f.heapIndex)
+	} else {
+		heap.Push(&w.fetchers, f)
+	}
+}
+
+// isStopped checks whether stopChan of fetcher was written to and removes stopped fetcher.
+// It must be called with Worker.mutex locked.
+func (w *Worker) isStopped(f *fetcher) bool {
+	if f.stopped {
+		return true
+	}
+	select {
+	case <-f.stopChan:
+		w.stop(f)
+	default:
+	}
+	return f.stopped
+}
+
+// watchStop removes fetcher as soon as its stopChan is written to, not only when it is checked by scheduler or executor
+func (w *Worker) watchStop(f *fetcher) {
+	select {
+	case <-f.stopChan:
+		w.mutex.Lock()
+		w.stop(f)
+		w.mutex.Unlock()
+		w.wakeUpScheduler()
+	case <-f.removed:
+	}
+}
+
+// stop must be called with Worker.mutex locked
+func (w *Worker) stop(f *fetcher) {
+	f.stopped = true
+	close(f.removed)
+	w.remove(f)
+}
+
+// remove drops fetcher with its waiting requests and retries. It must be called with Worker.mutex locked.
+func (w *Worker) remove(f *fetcher) {
+	if f.heapIndex >= 0 {
+		heap.Remove(&w.fetchers, f.heapIndex)
+	}
+	if f.spread {
+		w.spreadGroups.remove(f, w)
+	}
+	ready := w.ready[:0]
+	for _, r := range w.ready {
+		if r.fetcher != f {
+			ready = append(ready, r)
+		}
+	}
+	for i := len(ready); i < len(w.ready); i++ {
+		w.ready[i] = nil
+	}
+	w.ready = ready
+	f.waiting = false
+	var retries []*request
+	for _, r := range w.retries {
+		if r.fetcher == f {
+			retries = append(retries, r)
+		}
+	}
+	for _, r := range retries {
+		heap.Remove(&w.retries, r.heapIndex)
+		f.retrying--
+	}
+}
+
+type fetcherTick struct {
+	fetcher  *fetcher
+	tick     time.Time
+	interval time.Duration
+}
+
+func (w *Worker) schedule() {
+	for {
+		w.mutex.Lock()
+		now := w.clock.Now()
+		var skippedTicks []fetcherTick
+		for w.fetchers.Len() > 0 && !w.fetchers[0].nextRun.After(now) {
+			f := w.fetchers[0]
+			if w.isStopped(f) {
+				continue
+			}
+			if !w.tick(f) {
+				skippedTicks = append(skippedTicks, fetcherTick{fetcher: f, tick: f.nextRun})
+			}
+			// like time.Ticker, drop ticks if scheduler is late (more than jitter, as jittered run may be after the next tick)
+			w.reschedule(f, maxTime(f.nextTick, now.Add(-f.jitter)))
+		}
+		for w.retries.Len() > 0 && !w.retries[0].retryAt.After(now) {
+			r := heap.Pop(&w.retries).(*request)
+			w.ready = append(w.ready, r)
+			w.readyCond.Signal()
+		}
+		var scheduledTicks []fetcherTick
+		for _, f := range w.unreported {
+			f.unreported = false
+			scheduledTicks = append(scheduledTicks, fetcherTick{fetcher: f, tick: f.nextRun, interval: f.interval})
+		}
+		w.unreported = nil
+		deadline := now.Add(time.Hour)
+		if w.fetchers.Len() > 0 {
+			deadline = w.fetchers[0].nextRun
+		}
+		if w.retries.Len() > 0 && w.retries[0].retryAt.Before(deadline) {
+			deadline = w.retries[0].retryAt
+		}
+		w.mutex.Unlock()
+		for _, skipped := range skippedTicks {
+			skipped.fetcher.onFetch(api.UrlResponse{CreatedAt: skipped.tick, Skipped: true})
+		}
+		for _, scheduled := range scheduledTicks {
+			scheduled.fetcher.onSchedule(scheduled.tick, scheduled.interval)
+		}
+		timer, stopTimer := w.clock.Timer(deadline)
+		select {
+		case <-timer:
+		case <-w.wakeUp:
+		}
+		stopTimer()
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// tick handles tick of fetcher according to its overlap policy and returns false if tick is skipped.
+// It must be called with Worker.mutex locked.
+func (w *Worker) tick(f *fetcher) bool {
+	if !f.busy() {
+		w.enqueue(f)
+		return true
+	}
+	if f.waiting {
+		return false // previous request still waits for executor, there is no point in adding another one
+	}
+	switch f.url.Overlap {
+	case api.OverlapSkip:
+		return false
+	case api.OverlapQueue:
+		if f.queued {
+			return false
+		}
+		f.queued = true
+		return true
+	default:
+		w.enqueue(f)
+		return true
+	}
+}
+
+// enqueue must be called with Worker.mutex locked
+func (w *Worker) enqueue(f *fetcher) {
+	f.waiting = true
+	w.ready = append(w.ready, &request{fetcher: f, heapIndex: -1})
+	w.readyCond.Signal()
+}
+
+// newRandom returns source of jitter
+func newRandom() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// fetcherHeap implements heap.Interface, fetcher with the earliest next run is on top
+type fetcherHeap []*fetcher
+
+func (h fetcherHeap) Len() int {
+	return len(h)
+}
+
+func (h fetcherHeap) Less(i, j int) bool {
+	return h[i].nextRun.Before(h[j].nextRun)
+}
+
+func (h fetcherHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *fetcherHeap) Push(x interface{}) {
+	f := x.(*fetcher)
+	f.heapIndex = len(*h)
+	*h = append(*h, f)
+}
+
+func (h *fetcherHeap) Pop() interface{} {
+	old := *h
+	f := old[len(old)-1]
+	old[len(old)-1] = nil
+	f.heapIndex = -1
+	*h = old[:len(old)-1]
+	return f
+}
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/clock"
+)
+
+func TestTicks(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+
+	t.Run("with interval ticks are aligned to anchor and missed ticks are dropped", func(t *testing.T) {
+		f := &fetcher{interval: 5 * time.Second, anchor: start}
+		assert.Equal(t, start.Add(5*time.Second), f.tickAfter(start))
+		assert.Equal(t, start.Add(10*time.Second), f.tickAfter(start.Add(5*time.Second)))
+		assert.Equal(t, start.Add(25*time.Second), f.tickAfter(start.Add(23*time.Second)))
+	})
+	t.Run("with cron schedule ticks are computed in its time zone", func(t *testing.T) {
+		schedule, err := scheduleFunc(&api.Schedule{Cron: "0 9 * * MON-FRI", TimeZone: "America/New_York"})
+		require.NoError(t, err)
+		f := &fetcher{schedule: schedule}
+		assert.True(t, time.Date(2020, 8, 24, 13, 0, 0, 0, time.UTC).Equal(f.tickAfter(start)))
+		assert.True(t, time.Date(2020, 8, 31, 13, 0, 0, 0, time.UTC).Equal(f.tickAfter(time.Date(2020, 8, 28, 13, 0, 0, 0, time.UTC))))
+	})
+	t.Run("with one-shot schedule there is only one tick", func(t *testing.T) {
+		at := start.Add(time.Hour)
+		schedule, err := scheduleFunc(&api.Schedule{At: at})
+		require.NoError(t, err)
+		f := &fetcher{schedule: schedule}
+		assert.Equal(t, at, f.tickAfter(start))
+		assert.True(t, f.tickAfter(at).IsZero())
+	})
+	t.Run("with invalid cron expression returns error", func(t *testing.T) {
+		_, err := scheduleFunc(&api.Schedule{Cron: "* * *"})
+		assert.Error(t, err)
+	})
+}
+
+func TestOneShotSchedule(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	u, err := url.Parse("http://fetcher.test/once")
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	var nextRuns []time.Time
+	responses := make(chan api.UrlResponse, 10)
+	at := start.Add(300 * time.Millisecond)
+	w := New(WithClock(clock), WithTransport(&statusSequence{statuses: []int{200}}))
+	w.NewFetchRoutine(api.NewUrl{Url: u, Schedule: &api.Schedule{At: at}}, func(response api.UrlResponse) {
+		responses <- response
+	}, func(nextRun time.Time, interval time.Duration) {
+		mutex.Lock()
+		nextRuns = append(nextRuns, nextRun)
+		mutex.Unlock()
+	}, make(chan struct{}, 1))
+	require.Eventually(t, func() bool { return clock.HasTimer(at) }, 5*time.Second, time.Millisecond)
+	clock.Advance(300 * time.Millisecond)
+
+	response := <-responses
+	require.NotNil(t, response.Response)
+	assert.Equal(t, "abcde", string(response.Response))
+	assert.Equal(t, at, response.CreatedAt)
+	require.Eventually(t, func() bool { return clock.HasTimer(at.Add(time.Hour)) }, 5*time.Second, time.Millisecond,
+		"scheduler has no other tick to wait for")
+	assert.Empty(t, responses)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []time.Time{at, {}}, nextRuns)
+	assert.Equal(t, 0, w.GetWorkerStats().Fetchers)
+}
+
+func TestStoppedFetcherIsRemoved(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	u, err := url.Parse("http://fetcher.test/stopped")
+	require.NoError(t, err)
+	transport := &statusSequence{statuses: []int{200}}
+	w := New(WithClock(clock), WithTransport(transport), WithSpread())
+	stopChans := make([]chan struct{}, 0)
+	for _, intervalSeconds := range []int{60, 60, 3600} {
+		stopChan := make(chan struct{}, 1)
+		stopChans = append(stopChans, stopChan)
+		w.NewFetchRoutine(api.NewUrl{Url: u, IntervalSeconds: intervalSeconds}, func(response api.UrlResponse) {
+			assert.Fail(t, "stopped fetcher made request")
+		}, func(nextRun time.Time, interval time.Duration) {}, stopChan)
+	}
+	assert.Equal(t, 3, w.GetWorkerStats().Fetchers)
+
+	stopChans[2] <- struct{}{}
+	require.Eventually(t, func() bool { return w.GetWorkerStats().Fetchers == 2 }, 5*time.Second, time.Millisecond,
+		"fetcher is removed before its next tick")
+	stopChans[0] <- struct{}{}
+	stopChans[1] <- struct{}{}
+	require.Eventually(t, func() bool { return w.GetWorkerStats().Fetchers == 0 }, 5*time.Second, time.Millisecond)
+	w.mutex.Lock()
+	assert.Empty(t, w.spreadGroups)
+	w.mutex.Unlock()
+	clock.Advance(time.Hour)
+	assert.Equal(t, 0, transport.Requests())
+}
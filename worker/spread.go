@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"time"
+)
+
+// spreadGroups distributes ticks of fetchers with the same interval evenly across the interval, so that fetchers
+// created at once do not make requests at the same time
+type spreadGroups map[time.Duration]*spreadGroup
+
+type spreadGroup struct {
+	anchor  time.Time // ticks of the first member are at anchor + k * interval
+	members []*fetcher
+}
+
+// add must be called with Worker.mutex locked
+func (g spreadGroups) add(f *fetcher, w *Worker) {
+	group, ok := g[f.interval]
+	if !ok {
+		group = &spreadGroup{anchor: f.anchor}
+		g[f.interval] = group
+	}
+	group.members = append(group.members, f)
+	g.rebalance(f.interval, w)
+}
+
+// remove must be called with Worker.mutex locked
+func (g spreadGroups) remove(f *fetcher, w *Worker) {
+	group, ok := g[f.interval]
+	if !ok {
+		return
+	}
+	for i, member := range group.members {
+		if member == f {
+			group.members = append(group.members[:i], group.members[i+1:]...)
+			g.rebalance(f.interval, w)
+			return
+		}
+	}
+}
+
+// rebalance moves ticks of members of group, so that they are evenly distributed
+func (g spreadGroups) rebalance(interval time.Duration, w *Worker) {
+	group := g[interval]
+	members := group.members
+	if len(members) == 0 {
+		delete(g, interval)
+		return
+	}
+	now := w.clock.Now()
+	for i, f := range members {
+		f.anchor = group.anchor.Add(time.Duration(i) * interval / time.Duration(len(members)))
+		w.reschedule(f, now)
+	}
+}
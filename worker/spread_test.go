@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"fetcher/api"
+	"fetcher/clock"
+)
+
+// fetchRecorder registers fetchers in worker and collects their responses
+type fetchRecorder struct {
+	t         *testing.T
+	w         *Worker
+	server    *httptest.Server
+	responses chan recordedResponse
+}
+
+type recordedResponse struct {
+	fetcher  int
+	response api.UrlResponse
+}
+
+func newFetchRecorder(t *testing.T, options ...Option) *fetchRecorder {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("abcde"))
+	}))
+	return &fetchRecorder{t: t, w: New(options...), server: server, responses: make(chan recordedResponse, 100)}
+}
+
+// add returns stop channel of new fetcher, whose responses are recorded with given index
+func (r *fetchRecorder) add(index int, newUrl api.NewUrl) chan struct{} {
+	u, err := url.Parse(r.server.URL)
+	require.NoError(r.t, err)
+	newUrl.Url = u
+	stopChan := make(chan struct{}, 1)
+	r.w.NewFetchRoutine(newUrl, func(response api.UrlResponse) {
+		r.responses <- recordedResponse{fetcher: index, response: response}
+	}, func(nextRun time.Time, interval time.Duration) {}, stopChan)
+	return stopChan
+}
+
+func (r *fetchRecorder) next(t *testing.T) recordedResponse {
+	select {
+	case response := <-r.responses:
+		return response
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timeout while waiting for response")
+		return recordedResponse{}
+	}
+}
+
+func (r *fetchRecorder) assertNoResponse(t *testing.T) {
+	select {
+	case response := <-r.responses:
+		assert.Fail(t, "unexpected response", "%+v", response)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// nextRuns returns next runs of fetchers ordered by time
+func (r *fetchRecorder) nextRuns() []time.Time {
+	r.w.mutex.Lock()
+	defer r.w.mutex.Unlock()
+	nextRuns := make([]time.Time, 0, r.w.fetchers.Len())
+	for _, f := range r.w.fetchers {
+		nextRuns = append(nextRuns, f.nextRun)
+	}
+	sort.Slice(nextRuns, func(i, j int) bool {
+		return nextRuns[i].Before(nextRuns[j])
+	})
+	return nextRuns
+}
+
+func (r *fetchRecorder) close() {
+	r.server.Close()
+}
+
+func TestSpread(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	recorder := newFetchRecorder(t, WithClock(clock), WithSpread(), WithExecutors(4))
+	defer recorder.close()
+
+	stopChans := make([]chan struct{}, 4)
+	for i := 0; i < 4; i++ {
+		stopChans[i] = recorder.add(i, api.NewUrl{IntervalSeconds: 4})
+	}
+	recorder.add(4, api.NewUrl{IntervalSeconds: 10, Offset: 2500 * time.Millisecond})
+
+	t.Run("fetchers with the same interval are distributed evenly", func(t *testing.T) {
+		expected := []time.Time{
+			start.Add(time.Second),
+			start.Add(2 * time.Second),
+			start.Add(2500 * time.Millisecond), // fetcher with offset is not spread
+			start.Add(3 * time.Second),
+			start.Add(4 * time.Second),
+		}
+		assert.Equal(t, expected, recorder.nextRuns())
+	})
+	t.Run("each fetcher makes request in its own slot", func(t *testing.T) {
+		fetched := make(map[int]time.Time)
+		for i := 1; i <= 4; i++ {
+			clock.Advance(time.Second)
+			response := recorder.next(t)
+			fetched[response.fetcher] = response.response.CreatedAt
+			if i == 3 {
+				response := recorder.next(t)
+				fetched[response.fetcher] = response.response.CreatedAt
+			}
+			recorder.assertNoResponse(t)
+		}
+		expected := map[int]time.Time{
+			0: start.Add(4 * time.Second),
+			1: start.Add(time.Second),
+			2: start.Add(2 * time.Second),
+			3: start.Add(3 * time.Second),
+			4: start.Add(3 * time.Second), // ticked at 2.5s, but clock was moved by 1s
+		}
+		assert.Equal(t, expected, fetched)
+	})
+	t.Run("fetchers are redistributed when one is stopped", func(t *testing.T) {
+		stopChans[1] <- struct{}{}
+		clock.Advance(time.Second) // the stopped fetcher is removed on its tick
+		recorder.assertNoResponse(t)
+		// 3 fetchers are now at 0, 4/3 and 8/3 of the interval
+		expected := []time.Time{
+			start.Add(5*time.Second + time.Second/3),
+			start.Add(6*time.Second + 2*time.Second/3),
+			start.Add(8 * time.Second),
+			start.Add(12500 * time.Millisecond),
+		}
+		assert.Equal(t, expected, recorder.nextRuns())
+	})
+}
+
+func TestOffsetAndJitter(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	recorder := newFetchRecorder(t, WithClock(clock), withRandom(rand.New(rand.NewSource(1))))
+	defer recorder.close()
+
+	t.Run("offset delays the first fetch", func(t *testing.T) {
+		stopChan := recorder.add(0, api.NewUrl{IntervalSeconds: 10, Offset: 3 * time.Second})
+		assert.Equal(t, []time.Time{start.Add(3 * time.Second)}, recorder.nextRuns())
+		clock.Advance(3 * time.Second)
+		assert.Equal(t, start.Add(3*time.Second), recorder.next(t).response.CreatedAt)
+		assert.Equal(t, []time.Time{start.Add(13 * time.Second)}, recorder.nextRuns())
+		stopChan <- struct{}{}
+		clock.Advance(10 * time.Second)
+		recorder.assertNoResponse(t)
+		assert.Empty(t, recorder.nextRuns())
+	})
+	t.Run("jitter delays each fetch randomly without drift", func(t *testing.T) {
+		now := clock.Now()
+		recorder.add(1, api.NewUrl{IntervalSeconds: 10, Jitter: 2 * time.Second})
+		delays := make(map[time.Duration]bool)
+		for i := 1; i <= 5; i++ {
+			nextRuns := recorder.nextRuns()
+			require.Len(t, nextRuns, 1)
+			tick := now.Add(time.Duration(i) * 10 * time.Second)
+			delay := nextRuns[0].Sub(tick)
+			assert.True(t, delay >= 0 && delay < 2*time.Second, delay)
+			delays[delay] = true
+			clock.Advance(nextRuns[0].Sub(clock.Now()))
+			assert.Equal(t, nextRuns[0], recorder.next(t).response.CreatedAt)
+		}
+		assert.Greater(t, len(delays), 1)
+	})
+}
@@ -1,93 +1,215 @@
 package worker
 
 import (
-	"context"
-	"fmt"
-	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
-	"net/url"
+	"sync"
 	"time"
 
 	"fetcher/api"
+	"fetcher/clock"
 )
 
+// Worker fetches urls using fixed pool of executors. Single scheduler goroutine keeps all fetchers ordered by
+// their next tick and passes due requests (and retries of failed ones) to executors. Each fetcher has at most one
+// new request waiting for executor and waiting requests are served in FIFO order, so that no url is starved by others.
 type Worker struct {
+	defaultTimeout time.Duration
+	maxBodySize    int64
+	executors      int
+	maxPerHost     int
+	spread         bool
+	clock          clock.Clock
+	client         *http.Client
+
+	mutex        sync.Mutex
+	fetchers     fetcherHeap   // all fetchers ordered by next run
+	unreported   []*fetcher    // fetchers whose next run (or interval) was not passed to onSchedule yet
+	spreadGroups spreadGroups  // fetchers with interval and without offset, if spread is enabled
+	random       *rand.Rand    // source of jitter
+	wakeUp       chan struct{} // wakes scheduler up when fetchers are changed
+	ready        []*request    // requests waiting for executor
+	retries      requestHeap   // failed requests waiting for retry, ordered by retry time
+	readyCond    *sync.Cond    // signalled when request is added to ready
+	hostRunning  map[string]int
+	busy         int // number of executors making requests
 }
 
-const httpRequestTimeout = 5
-const abortSendingResponseTimeout = 10
-
-type urlResponseWithError struct {
-	Response api.UrlResponse
-	Error    error
-}
-
-func New() *Worker {
-	return &Worker{}
-}
-
-func (w *Worker) NewFetchRoutine(url api.NewUrl, onFetch func(response api.UrlResponse), stopChan chan struct{}) {
-	go func() {
-		responseChan := make(chan urlResponseWithError)
-		ticker := time.NewTicker(time.Duration(url.IntervalSeconds) * time.Second)
-		for {
-			select {
-			case <-stopChan:
-				ticker.Stop()
-				return
-			case response := <-responseChan:
-				if response.Error != nil {
-					log.Println(response.Error)
-				} else {
-					onFetch(response.Response)
-				}
-			case <-ticker.C:
-				go makeRequestAndSaveResponse(url, responseChan)
-			}
-		}
-	}()
+const (
+	DefaultTimeout     = 5 * time.Second
+	DefaultExecutors   = 100
+	DefaultMaxBodySize = 10 << 20
+)
+
+type Option func(w *Worker)
+
+// WithDefaultTimeout sets timeout of requests for urls which do not have their own timeout
+func WithDefaultTimeout(timeout time.Duration) Option {
+	return func(w *Worker) {
+		w.defaultTimeout = timeout
+	}
 }
 
-func makeRequestAndSaveResponse(url api.NewUrl, responseChan chan urlResponseWithError) {
-	response, err := makeHttpRequest(url.Url)
-	// Set timeout on writing response to avoid leaking goroutines in case url gets deleted, i.e.
-	// fetcher routine reads from stopChan and exits without reading response from this function
-	timer := time.NewTimer(abortSendingResponseTimeout * time.Second)
-	select {
-	case responseChan <- urlResponseWithError{Response: response, Error: err}:
-		timer.Stop()
-		return
-	case <-timer.C:
-		return
+// WithMaxBodySize sets size limit of response bodies for urls which do not have their own limit.
+// Longer bodies are truncated.
+func WithMaxBodySize(maxBodySize int64) Option {
+	return func(w *Worker) {
+		w.maxBodySize = maxBodySize
 	}
 }
 
-func makeHttpRequest(url *url.URL) (api.UrlResponse, error) {
-	createdAt := time.Now()
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, httpRequestTimeout*time.Second)
-	defer cancel()
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
-	if err != nil {
-		e := fmt.Errorf("could not create request for url %s: %s", url.String(), err)
-		return api.UrlResponse{}, e
+// WithExecutors sets number of requests which can be made concurrently
+func WithExecutors(executors int) Option {
+	return func(w *Worker) {
+		w.executors = executors
 	}
-	t1 := time.Now()
-	response, err := http.DefaultClient.Do(request)
-	t2 := time.Now()
-	duration := t2.Sub(t1)
-	if err != nil {
-		//errors.Is(err, context.DeadlineExceeded) or any other error - all are treated the same way
-		return api.UrlResponse{Response: nil, Duration: duration, CreatedAt: createdAt}, nil
+}
+
+// WithSpread makes worker distribute ticks of fetchers with the same interval (and without offset and backoff policy)
+// evenly across the interval. Ticks of already running fetchers are moved when fetchers are added or removed.
+func WithSpread() Option {
+	return func(w *Worker) {
+		w.spread = true
+	}
+}
+
+// WithClock replaces real time used by worker, e.g. with virtual time in tests
+func WithClock(clock clock.Clock) Option {
+	return func(w *Worker) {
+		w.clock = clock
+	}
+}
+
+// WithHTTPClient sets client used for all requests (http.DefaultClient by default).
+// Client timeout should not be set, as timeouts of requests are controlled by worker.
+func WithHTTPClient(client *http.Client) Option {
+	return func(w *Worker) {
+		w.client = client
+	}
+}
+
+// WithTransport makes worker use client with given transport, e.g. with custom proxy or TLS settings
+func WithTransport(transport http.RoundTripper) Option {
+	return WithHTTPClient(&http.Client{Transport: transport})
+}
+
+// withRandom is used in tests to make jitter deterministic
+func withRandom(random *rand.Rand) Option {
+	return func(w *Worker) {
+		w.random = random
+	}
+}
+
+// WithMaxPerHost limits number of concurrent requests to the same host (0 means no limit)
+func WithMaxPerHost(maxPerHost int) Option {
+	return func(w *Worker) {
+		w.maxPerHost = maxPerHost
+	}
+}
+
+func New(options ...Option) *Worker {
+	w := &Worker{
+		defaultTimeout: DefaultTimeout,
+		executors:      DefaultExecutors,
+		maxBodySize:    DefaultMaxBodySize,
+		clock:          clock.Real{},
+		client:         http.DefaultClient,
+		spreadGroups:   make(spreadGroups),
+		random:         newRandom(),
+		wakeUp:         make(chan struct{}, 1),
+		hostRunning:    make(map[string]int),
 	}
-	if response.StatusCode != http.StatusOK {
-		return api.UrlResponse{Response: nil, Duration: duration, CreatedAt: createdAt}, nil
+	for _, option := range options {
+		option(w)
 	}
-	bytes, err := ioutil.ReadAll(response.Body)
+	w.readyCond = sync.NewCond(&w.mutex)
+	go w.schedule()
+	for i := 0; i < w.executors; i++ {
+		go w.execute()
+	}
+	return w
+}
+
+// NewFetchRoutine registers url in scheduler. Fetcher is removed as soon as stopChan is written to and stopChan
+// is checked also on each of its ticks and before passing response to onFetch. Callbacks are called from scheduler and executor goroutines.
+// onSchedule receives also interval used for the next run, which differs from the configured one when the interval
+// is stretched by backoff policy (zero for urls with schedule).
+func (w *Worker) NewFetchRoutine(url api.NewUrl, onFetch func(response api.UrlResponse), onSchedule func(nextRun time.Time, interval time.Duration), stopChan chan struct{}) {
+	f := &fetcher{
+		url:         url,
+		timeout:     w.timeoutOf(url),
+		maxBodySize: w.maxBodySizeOf(url),
+		jitter:      url.Jitter,
+		host:        url.Url.Host,
+		onFetch:     onFetch,
+		onSchedule:  onSchedule,
+		stopChan:    stopChan,
+		removed:     make(chan struct{}),
+		heapIndex:   -1,
+	}
+	if url.Schedule != nil {
+		schedule, err := scheduleFunc(url.Schedule)
+		if err != nil {
+			log.Printf("could not schedule fetches of %s: %s", url.Url, err)
+			return
+		}
+		f.schedule = schedule
+	} else {
+		f.interval = time.Duration(url.IntervalSeconds) * time.Second
+	}
+	assertions, err := compileAssertions(url.Assertions)
 	if err != nil {
-		return api.UrlResponse{Response: nil, Duration: duration, CreatedAt: createdAt}, nil
+		log.Printf("could not check assertions of %s: %s", url.Url, err)
+		return
+	}
+	f.assertions = assertions
+	w.mutex.Lock()
+	now := w.clock.Now()
+	f.anchor = now
+	if url.Offset != 0 {
+		f.anchor = now.Add(url.Offset - f.interval) // so that the first tick is at now + offset
+	}
+	if w.spread && f.interval != 0 && url.Offset == 0 && url.Backoff == nil {
+		f.spread = true
+		w.spreadGroups.add(f, w)
+	} else {
+		w.reschedule(f, now)
+	}
+	w.mutex.Unlock()
+	go w.watchStop(f)
+	w.wakeUpScheduler()
+}
+
+func (w *Worker) wakeUpScheduler() {
+	select {
+	case w.wakeUp <- struct{}{}:
+	default: // scheduler is already going to wake up
+	}
+}
+
+func (w *Worker) GetWorkerStats() api.WorkerStats {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return api.WorkerStats{
+		Executors:  w.executors,
+		Busy:       w.busy,
+		Saturation: float64(w.busy) / float64(w.executors),
+		QueueDepth: len(w.ready),
+		Fetchers:   w.fetchers.Len(),
+	}
+}
+
+func (w *Worker) maxBodySizeOf(url api.NewUrl) int64 {
+	if url.MaxBodySize != 0 {
+		return url.MaxBodySize
+	}
+	return w.maxBodySize
+}
+
+func (w *Worker) timeoutOf(url api.NewUrl) time.Duration {
+	if url.Timeout != 0 {
+		return url.Timeout
 	}
-	responseStr := string(bytes)
-	return api.UrlResponse{Response: &responseStr, Duration: duration, CreatedAt: createdAt}, nil
+	return w.defaultTimeout
 }
@@ -1,18 +1,17 @@
 package worker_test
 
-//This is not a unit test and this test will take some time.
-//It tests integration of worker and urls packages.
+//These are not unit tests and some of them will take some time.
+//They test integration of worker and urls packages.
 //Api is not tested here just because it is easier to operate
 //directly on Go data structures instead of sending https requests and parsing json responses.
-//Besides, api is well-tested on unit level (unlike worker, which has no tests)
+//Besides, api is well-tested on unit level (unlike worker, which has unit tests only for single http request)
 
 import (
-	"fmt"
-	"math"
-	"math/rand"
+	"io/ioutil"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,45 +19,38 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"fetcher/api"
+	"fetcher/clock"
 	"fetcher/urls"
 	"fetcher/worker"
 )
 
 func TestWorkerAndUrlsIntergation(t *testing.T) {
-	fmt.Println("running TestWorkerAndUrlsIntergration - it will take 7-8s because timeouts are tested")
-
-	urlsBackend := urls.New(worker.New())
-
-	http.HandleFunc("/ok", func(writer http.ResponseWriter, request *http.Request) {
-		time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
-		_, err := writer.Write([]byte("abcde"))
-		if err != nil {
-			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
-	})
-	http.HandleFunc("/error", func(writer http.ResponseWriter, request *http.Request) {
-		time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
-		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-	})
-	http.HandleFunc("/timeout", func(writer http.ResponseWriter, request *http.Request) {
-		time.Sleep(6 * time.Second)
-		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-	})
-	server := httptest.NewServer(nil)
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	transport := &fakeTransport{}
+	// each /timeout url keeps 5 requests in progress, so default number of executors is not enough
+	urlsBackend := urls.New(worker.New(worker.WithClock(clock), worker.WithTransport(transport), worker.WithExecutors(1000)), urls.WithClock(clock))
+	ids := make([]uint64, 0, 100)
 
 	t.Run("Create 100 new urls ...", func(t *testing.T) {
 		for i := 0; i < 100; i++ {
-			u, err := url.Parse(server.URL + urlOfIteration(i))
+			u, err := url.Parse("http://fetcher.test" + urlOfIteration(i))
 			require.NoError(t, err)
 			newUrl := api.NewUrl{Url: u, IntervalSeconds: 1}
 			id, err := urlsBackend.PostNewUrl(newUrl)
 			require.NoError(t, err)
 			assert.Equal(t, id, api.UrlId{Id: uint64(i)})
+			ids = append(ids, id.Id)
 		}
 	})
 
-	t.Run("Wait for 7s so that all fetchers are run", func(t *testing.T) {
-		time.Sleep(7 * time.Second)
+	t.Run("Move virtual time by 7s so that all fetchers are run", func(t *testing.T) {
+		for step := 1; step <= 7; step++ {
+			clock.Advance(time.Second)
+			waitFor(t, func() bool {
+				return transport.Started() == 100*step && historyLengthsMatch(urlsBackend, ids, step)
+			})
+		}
 	})
 
 	t.Run("Assert that valid history is returned for each url", func(t *testing.T) {
@@ -69,10 +61,19 @@ func TestWorkerAndUrlsIntergation(t *testing.T) {
 			for _, r := range responses {
 				if i%3 == 0 {
 					require.NotNil(t, r.Response)
-					assert.Equal(t, "abcde", *r.Response)
+					assert.Equal(t, "abcde", string(r.Response))
+					assert.Equal(t, http.StatusOK, r.StatusCode)
 				} else {
 					assert.Nil(t, r.Response)
 				}
+				if i%3 == 1 {
+					assert.Equal(t, http.StatusNotFound, r.StatusCode)
+					assert.Equal(t, api.FetchErrorStatus, r.Error)
+				}
+				if i%3 == 2 {
+					assert.Equal(t, api.FetchErrorTimeout, r.Error)
+					assert.Equal(t, worker.DefaultTimeout, r.Duration)
+				}
 			}
 		}
 	})
@@ -101,7 +102,7 @@ func TestWorkerAndUrlsIntergation(t *testing.T) {
 			for _, r := range responses {
 				if i%3 == 0 {
 					require.NotNil(t, r.Response)
-					assert.Equal(t, "abcde", *r.Response)
+					assert.Equal(t, "abcde", string(r.Response))
 				} else {
 					assert.Nil(t, r.Response)
 				}
@@ -109,19 +110,26 @@ func TestWorkerAndUrlsIntergation(t *testing.T) {
 		}
 	})
 
-	t.Run("Assert that urls were fetched according to interval 1s with 0.5s precision", func(t *testing.T) {
+	t.Run("Assert that urls were fetched exactly according to interval 1s", func(t *testing.T) {
 		for i := 50; i < 100; i++ {
 			responses, err := urlsBackend.GetFetcherHistory(uint64(i))
 			assert.NoError(t, err)
-			if len(responses) > 1 {
-				assert.LessOrEqual(t, math.Abs(1.0-responses[1].CreatedAt.Sub(responses[0].CreatedAt).Seconds()), 0.5)
+			for j, r := range responses {
+				assert.Equal(t, start.Add(time.Duration(j+1)*time.Second), r.CreatedAt)
 			}
 		}
 	})
 
+	t.Run("Assert that deleted urls are not fetched anymore", func(t *testing.T) {
+		clock.Advance(time.Second)
+		waitFor(t, func() bool {
+			return transport.Started() == 100*7+50 && historyLengthsMatch(urlsBackend, ids[50:], 8)
+		})
+	})
+
 	t.Run("Create 50 another urls", func(t *testing.T) {
 		for i := 0; i < 50; i++ {
-			u, err := url.Parse(server.URL + urlOfIteration(i))
+			u, err := url.Parse("http://fetcher.test" + urlOfIteration(i))
 			require.NoError(t, err)
 			newUrl := api.NewUrl{Url: u, IntervalSeconds: 1}
 			id, err := urlsBackend.PostNewUrl(newUrl)
@@ -137,6 +145,76 @@ func TestWorkerAndUrlsIntergation(t *testing.T) {
 	})
 }
 
+// fakeTransport answers requests without network: /ok with "abcde", /error with 404 and /timeout never
+// (until request is cancelled)
+type fakeTransport struct {
+	mutex   sync.Mutex
+	started int
+}
+
+func (f *fakeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	f.mutex.Lock()
+	f.started++
+	f.mutex.Unlock()
+	switch request.URL.Path {
+	case "/ok":
+		return fakeResponse(request, http.StatusOK, "abcde"), nil
+	case "/error":
+		return fakeResponse(request, http.StatusNotFound, http.StatusText(http.StatusNotFound)), nil
+	default:
+		<-request.Context().Done()
+		return nil, request.Context().Err()
+	}
+}
+
+func (f *fakeTransport) Started() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.started
+}
+
+func fakeResponse(request *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		Status:     http.StatusText(statusCode),
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    request,
+	}
+}
+
+// historyLengthsMatch checks that all responses of given number of ticks were received
+func historyLengthsMatch(urlsBackend *urls.Urls, ids []uint64, ticks int) bool {
+	for _, id := range ids {
+		responses, err := urlsBackend.GetFetcherHistory(id)
+		if err != nil {
+			return false
+		}
+		expected := ticks
+		if id%3 == 2 {
+			expected = ticks - int(worker.DefaultTimeout/time.Second) // requests time out after 5 ticks
+			if expected < 0 {
+				expected = 0
+			}
+		}
+		if len(responses) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// waitFor waits (in real time) until asynchronous processing in worker and urls makes condition true
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "timeout while waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func urlOfIteration(iteration int) string {
 	if iteration%3 == 0 {
 		return "/ok"
@@ -146,3 +224,69 @@ func urlOfIteration(iteration int) string {
 	}
 	return "/timeout"
 }
+
+func TestOverlapPolicies(t *testing.T) {
+	start := time.Date(2020, 8, 24, 10, 0, 0, 0, time.UTC)
+	clock := clock.NewFake(start)
+	transport := newBlockingTransport()
+	urlsBackend := urls.New(worker.New(worker.WithClock(clock), worker.WithTransport(transport)), urls.WithClock(clock))
+	policies := []string{api.OverlapAllow, api.OverlapSkip, api.OverlapQueue}
+	for i, policy := range policies {
+		u, err := url.Parse("http://fetcher.test/slow/" + policy)
+		require.NoError(t, err)
+		id, err := urlsBackend.PostNewUrl(api.NewUrl{Url: u, IntervalSeconds: 1, Overlap: policy})
+		require.NoError(t, err)
+		assert.Equal(t, api.UrlId{Id: uint64(i)}, id)
+	}
+	// history returns numbers of made and skipped requests of url
+	history := func(id uint64) (int, int) {
+		responses, err := urlsBackend.GetFetcherHistory(id)
+		require.NoError(t, err)
+		made, skipped := 0, 0
+		for _, r := range responses {
+			if r.Skipped {
+				skipped++
+				assert.Nil(t, r.Response)
+			} else {
+				made++
+			}
+		}
+		return made, skipped
+	}
+
+	// the first requests are held by transport during the next two ticks
+	for tick := 1; tick <= 3; tick++ {
+		clock.Advance(time.Second)
+		waitFor(t, func() bool {
+			_, skipped := history(1)
+			return transport.Running("http://fetcher.test/slow/allow") == tick && skipped == tick-1
+		})
+	}
+	waitFor(t, func() bool {
+		_, skipped := history(2)
+		return skipped == 1
+	})
+
+	t.Run("with overlap allowed requests run concurrently", func(t *testing.T) {
+		assert.Equal(t, 3, transport.MaxRunning("http://fetcher.test/slow/allow"))
+		_, skipped := history(0)
+		assert.Equal(t, 0, skipped)
+	})
+	t.Run("with overlap skipped only one request runs and ticks are recorded as skipped", func(t *testing.T) {
+		assert.Equal(t, 1, transport.MaxRunning("http://fetcher.test/slow/skip"))
+		made, skipped := history(1)
+		assert.Equal(t, 0, made)
+		assert.Equal(t, 2, skipped)
+	})
+	t.Run("with overlap queued only one request runs and request is started after previous one", func(t *testing.T) {
+		made, skipped := history(2)
+		assert.Equal(t, 0, made)
+		assert.Equal(t, 1, skipped, "only one request is queued")
+		transport.Release(t, "http://fetcher.test/slow/queue")
+		waitFor(t, func() bool {
+			made, _ := history(2)
+			return made == 1 && transport.Running("http://fetcher.test/slow/queue") == 1
+		})
+		assert.Equal(t, 1, transport.MaxRunning("http://fetcher.test/slow/queue"))
+	})
+}